@@ -0,0 +1,195 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"go.uber.org/zap"
+
+	"github.com/jdholdren/karma/internal/core/models"
+)
+
+// runMigrate brings the database up to date without doing anything else
+func runMigrate(ctx context.Context, l *zap.SugaredLogger, cfg config, args []string) error {
+	fs := flag.NewFlagSet("migrate", flag.ExitOnError)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	sqlDB, err := setupDB(cfg)
+	if err != nil {
+		return fmt.Errorf("error opening db: %s", err)
+	}
+	defer sqlDB.Close()
+
+	l.Info("migrations are up to date")
+
+	return nil
+}
+
+// runRegister syncs commands with discord without serving
+func runRegister(ctx context.Context, l *zap.SugaredLogger, cfg config, args []string) error {
+	fs := flag.NewFlagSet("register", flag.ExitOnError)
+	dryRun := fs.Bool("dry-run", false, "print what would change without changing it")
+	force := fs.Bool("force", false, "sync guilds even if their commands haven't changed since the last sync")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	sqlDB, err := setupDB(cfg)
+	if err != nil {
+		return fmt.Errorf("error opening db: %s", err)
+	}
+	defer sqlDB.Close()
+
+	cr := newCore(cfg, sqlDB)
+	s, err := newServer(l, cfg, cr)
+	if err != nil {
+		return err
+	}
+
+	return syncCommands(ctx, l, cfg, cr, s, *dryRun, *force)
+}
+
+// runExport writes everything about karma in a guild out as JSON
+func runExport(ctx context.Context, l *zap.SugaredLogger, cfg config, args []string) error {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	guildID := fs.String("guild", "", "the guild to export (required)")
+	out := fs.String("o", "", "the file to write to, defaults to stdout")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *guildID == "" {
+		return errors.New("-guild is required")
+	}
+
+	sqlDB, err := setupDB(cfg)
+	if err != nil {
+		return fmt.Errorf("error opening db: %s", err)
+	}
+	defer sqlDB.Close()
+
+	exp, err := newCore(cfg, sqlDB).Export(ctx, *guildID)
+	if err != nil {
+		return err
+	}
+
+	var w io.Writer = os.Stdout
+	if *out != "" {
+		file, err := os.Create(*out)
+		if err != nil {
+			return fmt.Errorf("error creating export file: %s", err)
+		}
+		defer file.Close()
+		w = file
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(exp); err != nil {
+		return fmt.Errorf("error writing export: %s", err)
+	}
+
+	l.Infow("exported guild", "guild_id", *guildID, "counts", len(exp.Counts), "events", len(exp.Events), "seasons", len(exp.Seasons))
+
+	return nil
+}
+
+// runImport replaces everything about karma in a guild with an export
+func runImport(ctx context.Context, l *zap.SugaredLogger, cfg config, args []string) error {
+	fs := flag.NewFlagSet("import", flag.ExitOnError)
+	in := fs.String("f", "", "the file to read from, defaults to stdin")
+	guildID := fs.String("guild", "", "import into this guild instead of the one exported")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	var r io.Reader = os.Stdin
+	if *in != "" {
+		file, err := os.Open(*in)
+		if err != nil {
+			return fmt.Errorf("error opening export file: %s", err)
+		}
+		defer file.Close()
+		r = file
+	}
+
+	var exp models.GuildExport
+	if err := json.NewDecoder(r).Decode(&exp); err != nil {
+		return fmt.Errorf("error reading export: %s", err)
+	}
+	if *guildID != "" {
+		exp.GuildID = *guildID
+	}
+
+	sqlDB, err := setupDB(cfg)
+	if err != nil {
+		return fmt.Errorf("error opening db: %s", err)
+	}
+	defer sqlDB.Close()
+
+	if err := newCore(cfg, sqlDB).Import(ctx, exp); err != nil {
+		return err
+	}
+
+	l.Infow("imported guild", "guild_id", exp.GuildID, "counts", len(exp.Counts), "events", len(exp.Events), "seasons", len(exp.Seasons))
+
+	return nil
+}
+
+// runAdmin changes someone's karma the same way /karmaadmin does, recorded in the audit log
+func runAdmin(ctx context.Context, l *zap.SugaredLogger, cfg config, args []string) error {
+	if len(args) == 0 {
+		return errors.New("admin needs an action: set, adjust, reset or transfer")
+	}
+	action, args := args[0], args[1:]
+
+	fs := flag.NewFlagSet("admin "+action, flag.ExitOnError)
+	guildID := fs.String("guild", "", "the guild (required)")
+	userID := fs.String("user", "", "the user whose karma to change (required)")
+	n := fs.Int("n", 0, "the new count for set, or how much to add for adjust")
+	toID := fs.String("to", "", "the user to move karma to for transfer")
+	modID := fs.String("moderator", "cli", "who to record in the audit log as making the change")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *guildID == "" || *userID == "" {
+		return errors.New("-guild and -user are required")
+	}
+
+	sqlDB, err := setupDB(cfg)
+	if err != nil {
+		return fmt.Errorf("error opening db: %s", err)
+	}
+	defer sqlDB.Close()
+	cr := newCore(cfg, sqlDB)
+
+	var count models.KarmaCount
+	switch action {
+	case "set":
+		count, err = cr.SetKarma(ctx, *guildID, *modID, *userID, *n)
+	case "adjust":
+		count, err = cr.AdjustKarma(ctx, *guildID, *modID, *userID, *n)
+	case "reset":
+		count, err = cr.ResetKarma(ctx, *guildID, *modID, *userID)
+	case "transfer":
+		if *toID == "" {
+			return errors.New("-to is required for transfer")
+		}
+		count, err = cr.TransferKarma(ctx, *guildID, *modID, *userID, *toID)
+	default:
+		return fmt.Errorf("unknown admin action %q", action)
+	}
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("%s now has %d karma\n", count.UserID, count.Count)
+
+	return nil
+}
@@ -0,0 +1,190 @@
+package core
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/jdholdren/karma/internal/core/db"
+	"github.com/jdholdren/karma/internal/core/models"
+)
+
+// The actions recorded in the audit log
+const (
+	AuditSet      = "set"
+	AuditAdjust   = "adjust"
+	AuditReset    = "reset"
+	AuditTransfer = "transfer"
+)
+
+var (
+	// ErrSameUser is returned when transferring karma from a user to themselves
+	ErrSameUser = errors.New("cannot transfer karma to the same user")
+	// ErrRewardNotFound is returned when removing a reward the guild doesn't have
+	ErrRewardNotFound = errors.New("no reward at that threshold")
+)
+
+// SetKarma overwrites the user's count on behalf of a moderator
+func (c Core) SetKarma(ctx context.Context, guildID, moderatorID, userID string, count int) (models.KarmaCount, error) {
+	return c.moderate(ctx, guildID, moderatorID, AuditSet, userID, func(tx db.DB) error {
+		return tx.SetCount(ctx, guildID, userID, count)
+	})
+}
+
+// AdjustKarma adds the amount, which can be negative, to the user's count on behalf of a moderator.
+// Unlike gifts it isn't limited and doesn't show up in the ledger.
+func (c Core) AdjustKarma(ctx context.Context, guildID, moderatorID, userID string, amount int) (models.KarmaCount, error) {
+	return c.moderate(ctx, guildID, moderatorID, AuditAdjust, userID, func(tx db.DB) error {
+		return tx.IncrementCount(ctx, guildID, userID, amount)
+	})
+}
+
+// ResetKarma sets the user's count back to zero on behalf of a moderator
+func (c Core) ResetKarma(ctx context.Context, guildID, moderatorID, userID string) (models.KarmaCount, error) {
+	return c.moderate(ctx, guildID, moderatorID, AuditReset, userID, func(tx db.DB) error {
+		return tx.SetCount(ctx, guildID, userID, 0)
+	})
+}
+
+// TransferKarma merges an old account into a new one on behalf of a moderator: the old count
+// is added to the new one and the old account's history is moved over, apart from gifts
+// between the two. It returns the new account's count.
+func (c Core) TransferKarma(ctx context.Context, guildID, moderatorID, fromID, toID string) (models.KarmaCount, error) {
+	if fromID == toID {
+		return models.KarmaCount{}, ErrSameUser
+	}
+
+	var count models.KarmaCount
+	err := c.db.WithTx(ctx, func(tx db.DB) error {
+		from, err := c.countTx(ctx, tx, guildID, fromID)
+		if err != nil {
+			return err
+		}
+
+		if err := tx.IncrementCount(ctx, guildID, toID, from.Count); err != nil {
+			return fmt.Errorf("error adding to count: %s", err)
+		}
+		if err := tx.DeleteCount(ctx, guildID, fromID); err != nil {
+			return fmt.Errorf("error removing old count: %s", err)
+		}
+		if err := tx.ReassignKarmaEvents(ctx, guildID, fromID, toID); err != nil {
+			return fmt.Errorf("error moving history: %s", err)
+		}
+
+		count, err = tx.GetKarmaCount(ctx, guildID, toID)
+		if err != nil {
+			return fmt.Errorf("error getting count: %s", err)
+		}
+
+		return tx.InsertAuditEntry(ctx, models.AuditEntry{
+			GuildID:      guildID,
+			ModeratorID:  moderatorID,
+			Action:       AuditTransfer,
+			UserID:       fromID,
+			TargetUserID: toID,
+			OldCount:     from.Count,
+			NewCount:     count.Count,
+			CreatedAt:    c.now().Unix(),
+		})
+	})
+	if err != nil {
+		return models.KarmaCount{}, err
+	}
+
+	return count, nil
+}
+
+// GetAuditLog returns the guild's most recent moderator changes, newest first
+func (c Core) GetAuditLog(ctx context.Context, guildID string, limit int) ([]models.AuditEntry, error) {
+	entries, err := c.db.GetAuditEntries(ctx, guildID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("error getting audit log: %s", err)
+	}
+
+	return entries, nil
+}
+
+// SetRoleReward makes the role the reward for reaching the threshold, replacing
+// any other role at that threshold
+func (c Core) SetRoleReward(ctx context.Context, guildID string, threshold int, roleID string) error {
+	err := c.db.UpsertRoleReward(ctx, models.RoleReward{GuildID: guildID, Threshold: threshold, RoleID: roleID})
+	if err != nil {
+		return fmt.Errorf("error setting reward: %s", err)
+	}
+
+	return nil
+}
+
+// RemoveRoleReward stops giving out a role at the threshold. Members who already have
+// it keep it.
+func (c Core) RemoveRoleReward(ctx context.Context, guildID string, threshold int) error {
+	found, err := c.db.DeleteRoleReward(ctx, guildID, threshold)
+	if err != nil {
+		return fmt.Errorf("error removing reward: %s", err)
+	}
+	if !found {
+		return ErrRewardNotFound
+	}
+
+	return nil
+}
+
+// GetRoleRewards returns the guild's rewards, lowest threshold first
+func (c Core) GetRoleRewards(ctx context.Context, guildID string) ([]models.RoleReward, error) {
+	rewards, err := c.db.GetRoleRewards(ctx, guildID)
+	if err != nil {
+		return nil, fmt.Errorf("error getting rewards: %s", err)
+	}
+
+	return rewards, nil
+}
+
+// moderate applies a moderator's change to a single user's count and records it in the
+// audit log, all in one transaction
+func (c Core) moderate(ctx context.Context, guildID, moderatorID, action, userID string, change func(tx db.DB) error) (models.KarmaCount, error) {
+	var count models.KarmaCount
+	err := c.db.WithTx(ctx, func(tx db.DB) error {
+		old, err := c.countTx(ctx, tx, guildID, userID)
+		if err != nil {
+			return err
+		}
+
+		if err := change(tx); err != nil {
+			return fmt.Errorf("error changing count: %s", err)
+		}
+
+		count, err = tx.GetKarmaCount(ctx, guildID, userID)
+		if err != nil {
+			return fmt.Errorf("error getting count: %s", err)
+		}
+
+		return tx.InsertAuditEntry(ctx, models.AuditEntry{
+			GuildID:     guildID,
+			ModeratorID: moderatorID,
+			Action:      action,
+			UserID:      userID,
+			OldCount:    old.Count,
+			NewCount:    count.Count,
+			CreatedAt:   c.now().Unix(),
+		})
+	})
+	if err != nil {
+		return models.KarmaCount{}, err
+	}
+
+	return count, nil
+}
+
+// countTx gets the user's count within a transaction, which is zero if they don't have one
+func (c Core) countTx(ctx context.Context, tx db.DB, guildID, userID string) (models.KarmaCount, error) {
+	count, err := tx.GetKarmaCount(ctx, guildID, userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.KarmaCount{GuildID: guildID, UserID: userID}, nil
+	}
+	if err != nil {
+		return models.KarmaCount{}, fmt.Errorf("error getting count: %s", err)
+	}
+
+	return count, nil
+}
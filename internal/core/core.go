@@ -2,38 +2,398 @@ package core
 
 import (
 	"context"
+	"database/sql"
+	"errors"
 	"fmt"
+	"time"
 
 	"github.com/jdholdren/karma/internal/core/db"
 	"github.com/jdholdren/karma/internal/core/models"
 )
 
+var (
+	// ErrSelfKarma is returned when a user tries to give karma to themselves
+	ErrSelfKarma = errors.New("cannot give karma to yourself")
+	// ErrNegativeKarmaDisabled is returned when taking karma away in a guild that hasn't opted in
+	ErrNegativeKarmaDisabled = errors.New("negative karma is not enabled for this guild")
+	// ErrNothingToUndo is returned when there's no gift left to undo
+	ErrNothingToUndo = errors.New("no gift to undo")
+	// ErrNotGiver is returned when someone tries to undo a gift they didn't give
+	ErrNotGiver = errors.New("only the giver can undo a gift")
+	// ErrUndoWindowPassed is returned when a gift is too old to be undone
+	ErrUndoWindowPassed = errors.New("too late to undo the gift")
+	// ErrSeasonNotFound is returned when looking up a season that hasn't been closed
+	ErrSeasonNotFound = errors.New("season not found")
+	// ErrNotRanked is returned when looking up the rank of a user without any karma
+	ErrNotRanked = errors.New("user is not on the leaderboard")
+	// ErrUnknownCategory is returned when a gift's category isn't one the guild uses
+	ErrUnknownCategory = errors.New("unknown category")
+)
+
+// A RateLimitError is returned when a giver has to wait before they can give karma again
+type RateLimitError struct {
+	Reason  string
+	RetryAt time.Time
+}
+
+func (e RateLimitError) Error() string {
+	return fmt.Sprintf("%s, retry at %s", e.Reason, e.RetryAt.Format(time.RFC3339))
+}
+
+// An AmountError is returned when a gift is for more than the guild allows, or less than one
+type AmountError struct {
+	Max int
+}
+
+func (e AmountError) Error() string {
+	return fmt.Sprintf("amount must be between 1 and %d", e.Max)
+}
+
+// Config holds the limits on how karma can be given. The zero value
+// has no limits. They're the defaults for each guild's settings.
+type Config struct {
+	// How long a giver has to wait before giving the same receiver karma again
+	PairCooldown time.Duration
+	// How much karma a giver can hand out per UTC day
+	DailyBudget int
+	// The most karma that can be given in one gift, defaulting to one
+	MaxGiftAmount int
+	// Per-guild overrides of MaxGiftAmount
+	GuildMaxGiftAmounts map[string]int
+
+	// Guilds where karma can be taken away
+	NegativeKarmaGuildIDs []string
+	// If taking karma away can push a total below zero
+	AllowNegativeTotals bool
+
+	// How long a giver has to take back a gift
+	UndoWindow time.Duration
+
+	// The categories gifts can be tagged with
+	Categories []string
+	// Per-guild overrides of Categories
+	GuildCategories map[string][]string
+
+	// The channel each guild's milestones and new leaders are announced in
+	AnnounceChannelIDs map[string]string
+}
+
 type Core struct {
-	db db.DB
+	db  db.DB
+	cfg Config
+
+	now func() time.Time // Overridable for tests
 }
 
-func New(db db.DB) Core {
+func New(db db.DB, cfg Config) Core {
 	return Core{
-		db: db,
+		db:  db,
+		cfg: cfg,
+		now: time.Now,
 	}
 }
 
-// AddKarma increments the karma for a user
-func (c Core) AddKarma(ctx context.Context, guildID, userID string) (models.KarmaCount, error) {
-	if err := c.db.IncrementCount(ctx, guildID, userID); err != nil {
-		return models.KarmaCount{}, fmt.Errorf("error incrementing count: %s", err)
+// AddKarma gives the event's amount of karma from its giver to its receiver, recording the
+// event in the ledger alongside the updated count
+func (c Core) AddKarma(ctx context.Context, ev models.KarmaEvent) (models.KarmaChange, error) {
+	gs, err := c.GuildSettings(ctx, ev.GuildID)
+	if err != nil {
+		return models.KarmaChange{}, err
+	}
+
+	if err := validateGift(ev, gs); err != nil {
+		return models.KarmaChange{}, err
 	}
 
-	count, err := c.db.GetKarmaCount(ctx, guildID, userID)
+	return c.applyEvent(ctx, ev, gs)
+}
+
+// AddKarmaToMany gives karma for each of the events in a single transaction: either every
+// gift goes through or none of them do. The changes are returned in the same order.
+func (c Core) AddKarmaToMany(ctx context.Context, evs []models.KarmaEvent) ([]models.KarmaChange, error) {
+	if len(evs) == 0 {
+		return nil, nil
+	}
+
+	// The gifts all come from the same interaction, so the same guild
+	gs, err := c.GuildSettings(ctx, evs[0].GuildID)
 	if err != nil {
-		return models.KarmaCount{}, fmt.Errorf("error getting count: %s", err)
+		return nil, err
 	}
 
-	return count, nil
+	for _, ev := range evs {
+		if err := validateGift(ev, gs); err != nil {
+			return nil, err
+		}
+	}
+
+	now := c.now()
+	changes := make([]models.KarmaChange, 0, len(evs))
+	err = c.db.WithTx(ctx, func(tx db.DB) error {
+		for _, ev := range evs {
+			change, err := c.applyEventTx(ctx, tx, ev, now, gs)
+			if err != nil {
+				return err
+			}
+
+			changes = append(changes, change)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return changes, nil
+}
+
+// validateGift checks the parts of a gift that don't need the database
+func validateGift(ev models.KarmaEvent, gs GuildSettings) error {
+	if ev.Amount < 1 || ev.Amount > gs.MaxGiftAmount {
+		return AmountError{Max: gs.MaxGiftAmount}
+	}
+	if ev.Category != "" && !contains(gs.Categories, ev.Category) {
+		return ErrUnknownCategory
+	}
+
+	return nil
+}
+
+// RemoveKarma takes one karma away from the event's receiver. It's only allowed in guilds
+// that have opted in to negative karma. If the receiver's total can't go any lower, nothing
+// is recorded and the returned event has no ID.
+func (c Core) RemoveKarma(ctx context.Context, ev models.KarmaEvent) (models.KarmaChange, error) {
+	gs, err := c.GuildSettings(ctx, ev.GuildID)
+	if err != nil {
+		return models.KarmaChange{}, err
+	}
+
+	if !gs.NegativeKarma {
+		return models.KarmaChange{}, ErrNegativeKarmaDisabled
+	}
+
+	ev.Amount = -1
+	return c.applyEvent(ctx, ev, gs)
 }
 
+func contains(ss []string, s string) bool {
+	for _, v := range ss {
+		if v == s {
+			return true
+		}
+	}
+
+	return false
+}
+
+// applyEvent checks the event against the limits, then records it in the ledger and applies
+// its amount to the receiver's count in a single transaction
+func (c Core) applyEvent(ctx context.Context, ev models.KarmaEvent, gs GuildSettings) (models.KarmaChange, error) {
+	var change models.KarmaChange
+	err := c.db.WithTx(ctx, func(tx db.DB) error {
+		var err error
+		change, err = c.applyEventTx(ctx, tx, ev, c.now(), gs)
+		return err
+	})
+	if err != nil {
+		return models.KarmaChange{}, err
+	}
+
+	return change, nil
+}
+
+// applyEventTx is the body of applyEvent, for running inside an existing transaction
+func (c Core) applyEventTx(ctx context.Context, tx db.DB, ev models.KarmaEvent, now time.Time, gs GuildSettings) (models.KarmaChange, error) {
+	if ev.GiverID == ev.ReceiverID {
+		return models.KarmaChange{}, ErrSelfKarma
+	}
+
+	ev.CreatedAt = now.Unix()
+
+	if err := checkLimits(ctx, tx, ev, now, gs); err != nil {
+		return models.KarmaChange{}, err
+	}
+
+	// With the floor at zero there may be nothing to take, and then there's nothing to record
+	if ev.Amount < 0 && !gs.NegativeTotals {
+		count, err := c.countTx(ctx, tx, ev.GuildID, ev.ReceiverID)
+		if err != nil {
+			return models.KarmaChange{}, err
+		}
+		if count.Count <= 0 {
+			return models.KarmaChange{Event: ev, Count: count}, nil
+		}
+	}
+
+	var err error
+	ev.ID, err = tx.InsertKarmaEvent(ctx, ev)
+	if err != nil {
+		return models.KarmaChange{}, fmt.Errorf("error recording event: %s", err)
+	}
+
+	if ev.Amount > 0 {
+		if err := tx.IncrementCount(ctx, ev.GuildID, ev.ReceiverID, ev.Amount); err != nil {
+			return models.KarmaChange{}, fmt.Errorf("error incrementing count: %s", err)
+		}
+	} else {
+		if err := tx.DecrementCount(ctx, ev.GuildID, ev.ReceiverID, !gs.NegativeTotals); err != nil {
+			return models.KarmaChange{}, fmt.Errorf("error decrementing count: %s", err)
+		}
+	}
+
+	count, err := tx.GetKarmaCount(ctx, ev.GuildID, ev.ReceiverID)
+	if err != nil {
+		return models.KarmaChange{}, fmt.Errorf("error getting count: %s", err)
+	}
+
+	change := models.KarmaChange{Event: ev, Count: count}
+	if ev.Amount <= 0 { // Only gifts can carry someone past a milestone or into first place
+		return change, nil
+	}
+
+	change.Rewards, err = tx.GetRoleRewardsBetween(ctx, ev.GuildID, count.Count-ev.Amount, count.Count)
+	if err != nil {
+		return models.KarmaChange{}, fmt.Errorf("error getting rewards: %s", err)
+	}
+
+	// There has to have been someone to overtake
+	highest, err := tx.GetHighestCountExcept(ctx, ev.GuildID, ev.ReceiverID)
+	if err != nil {
+		return models.KarmaChange{}, fmt.Errorf("error getting leader: %s", err)
+	}
+	if highest.Valid {
+		old := int64(count.Count - ev.Amount)
+		change.TookFirstPlace = old <= highest.Int64 && int64(count.Count) > highest.Int64
+	}
+
+	return change, nil
+}
+
+// UndoGift reverts a gift the giver made within the undo window. The count goes back down
+// and the event is marked as revoked rather than deleted, though unless totals can go below
+// zero it won't take back more than the receiver still has. An eventID of zero undoes the
+// giver's most recent gift.
+func (c Core) UndoGift(ctx context.Context, guildID, giverID string, eventID int64) (models.KarmaChange, error) {
+	gs, err := c.GuildSettings(ctx, guildID)
+	if err != nil {
+		return models.KarmaChange{}, err
+	}
+
+	now := c.now()
+
+	var change models.KarmaChange
+	err = c.db.WithTx(ctx, func(tx db.DB) error {
+		var (
+			ev  models.KarmaEvent
+			err error
+		)
+		if eventID == 0 {
+			ev, err = tx.GetLastGiftByGiver(ctx, guildID, giverID)
+		} else {
+			ev, err = tx.GetKarmaEvent(ctx, guildID, eventID)
+		}
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrNothingToUndo
+		}
+		if err != nil {
+			return fmt.Errorf("error getting event: %s", err)
+		}
+
+		if ev.GiverID != giverID {
+			return ErrNotGiver
+		}
+		if ev.RevokedAt != nil || ev.Amount < 1 {
+			return ErrNothingToUndo
+		}
+		if now.After(time.Unix(ev.CreatedAt, 0).Add(gs.UndoWindow)) {
+			return ErrUndoWindowPassed
+		}
+
+		at := now.Unix()
+		if err := tx.RevokeKarmaEvent(ctx, ev.ID, at); err != nil {
+			return fmt.Errorf("error revoking event: %s", err)
+		}
+		ev.RevokedAt = &at
+
+		count, err := c.countTx(ctx, tx, ev.GuildID, ev.ReceiverID)
+		if err != nil {
+			return err
+		}
+
+		// The count may have been reset since the gift, by a new season or a moderator, so
+		// only take back what's still there unless totals can go below zero
+		take := ev.Amount
+		if !gs.NegativeTotals && take > count.Count {
+			take = count.Count
+		}
+		if take <= 0 {
+			change = models.KarmaChange{Event: ev, Count: count}
+			return nil
+		}
+
+		if err := tx.IncrementCount(ctx, ev.GuildID, ev.ReceiverID, -take); err != nil {
+			return fmt.Errorf("error reverting count: %s", err)
+		}
+
+		count, err = tx.GetKarmaCount(ctx, ev.GuildID, ev.ReceiverID)
+		if err != nil {
+			return fmt.Errorf("error getting count: %s", err)
+		}
+
+		change = models.KarmaChange{Event: ev, Count: count}
+		return nil
+	})
+	if err != nil {
+		return models.KarmaChange{}, err
+	}
+
+	return change, nil
+}
+
+// checkLimits makes sure the event doesn't break the pair cooldown or the giver's daily budget
+func checkLimits(ctx context.Context, tx db.DB, ev models.KarmaEvent, now time.Time, gs GuildSettings) error {
+	if gs.PairCooldown > 0 {
+		last, err := tx.GetLastGiftTime(ctx, ev.GuildID, ev.GiverID, ev.ReceiverID)
+		if err != nil {
+			return fmt.Errorf("error getting last gift time: %s", err)
+		}
+
+		retryAt := time.Unix(last, 0).UTC().Add(gs.PairCooldown)
+		if last != 0 && now.Before(retryAt) {
+			return RateLimitError{
+				Reason:  "changed this user's karma too recently",
+				RetryAt: retryAt,
+			}
+		}
+	}
+
+	if gs.DailyBudget > 0 && ev.Amount > 0 {
+		y, m, d := now.UTC().Date()
+		dayStart := time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+
+		given, err := tx.GetAmountGivenSince(ctx, ev.GuildID, ev.GiverID, dayStart.Unix())
+		if err != nil {
+			return fmt.Errorf("error getting amount given: %s", err)
+		}
+
+		if given+ev.Amount > gs.DailyBudget {
+			return RateLimitError{
+				Reason:  "daily karma budget used up",
+				RetryAt: dayStart.AddDate(0, 0, 1),
+			}
+		}
+	}
+
+	return nil
+}
+
+// GetKarma returns the user's live count, which is zero if they've never received karma
 func (c Core) GetKarma(ctx context.Context, guildID, userID string) (models.KarmaCount, error) {
 	count, err := c.db.GetKarmaCount(ctx, guildID, userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.KarmaCount{GuildID: guildID, UserID: userID}, nil
+	}
 	if err != nil {
 		return models.KarmaCount{}, fmt.Errorf("error getting count: %s", err)
 	}
@@ -41,11 +401,230 @@ func (c Core) GetKarma(ctx context.Context, guildID, userID string) (models.Karm
 	return count, nil
 }
 
-func (c Core) GetTopCounts(ctx context.Context, guildID string, top int) ([]models.KarmaCount, error) {
-	counts, err := c.db.GetTopCountsForGuild(ctx, guildID, top)
+func (c Core) GetTopCounts(ctx context.Context, guildID string, top int) ([]models.RankedCount, error) {
+	counts, err := c.db.GetTopCountsForGuild(ctx, guildID, top, 0)
 	if err != nil {
 		return nil, fmt.Errorf("error getting count: %s", err)
 	}
 
 	return counts, nil
 }
+
+// GetCategoryCounts breaks down the karma the user received this season by category. Karma
+// given without a category is under the empty category. It's built from the gifts alone, so
+// a moderator's changes to the user's total aren't in any category and the breakdown won't
+// always add up to it.
+func (c Core) GetCategoryCounts(ctx context.Context, guildID, userID string) ([]models.CategoryCount, error) {
+	since, err := c.periodSince(ctx, guildID, PeriodAllTime)
+	if err != nil {
+		return nil, err
+	}
+
+	ccs, err := c.db.GetCategoryCounts(ctx, guildID, userID, since)
+	if err != nil {
+		return nil, fmt.Errorf("error getting category counts: %s", err)
+	}
+
+	return ccs, nil
+}
+
+// GetRank returns the user's place on the leaderboard along with up to `around` users
+// directly above and below them, in leaderboard order
+func (c Core) GetRank(ctx context.Context, guildID, userID string, around int) ([]models.RankedCount, error) {
+	counts, err := c.db.GetRankedCountsAround(ctx, guildID, userID, around)
+	if err != nil {
+		return nil, fmt.Errorf("error getting ranks: %s", err)
+	}
+	if len(counts) == 0 {
+		return nil, ErrNotRanked
+	}
+
+	return counts, nil
+}
+
+// A Period is a window of time that leaderboards can be limited to
+type Period string
+
+const (
+	PeriodWeek    Period = "week"
+	PeriodMonth   Period = "month"
+	PeriodYear    Period = "year"
+	PeriodAllTime Period = "all"
+)
+
+// Start returns when the period containing now began, in UTC. Weeks start on Monday.
+// PeriodAllTime has no start and returns the zero time.
+func (p Period) Start(now time.Time) time.Time {
+	y, m, d := now.UTC().Date()
+	switch p {
+	case PeriodWeek:
+		daysSinceMonday := (int(now.UTC().Weekday()) + 6) % 7
+		return time.Date(y, m, d-daysSinceMonday, 0, 0, 0, 0, time.UTC)
+	case PeriodMonth:
+		return time.Date(y, m, 1, 0, 0, 0, 0, time.UTC)
+	case PeriodYear:
+		return time.Date(y, time.January, 1, 0, 0, 0, 0, time.UTC)
+	default:
+		return time.Time{}
+	}
+}
+
+// GetTopCountsForPeriod returns a page of the leaderboard limited to karma received during the
+// current period. If a category is given, only karma given in that category counts. Other than
+// the all time board without a category, these are built from the gifts made this season and
+// leave out a moderator's changes to totals.
+func (c Core) GetTopCountsForPeriod(ctx context.Context, guildID string, period Period, category string, limit, offset int) ([]models.RankedCount, error) {
+	if (period == PeriodAllTime || period == "") && category == "" {
+		counts, err := c.db.GetTopCountsForGuild(ctx, guildID, limit, offset)
+		if err != nil {
+			return nil, fmt.Errorf("error getting counts: %s", err)
+		}
+
+		return counts, nil
+	}
+
+	since, err := c.periodSince(ctx, guildID, period)
+	if err != nil {
+		return nil, err
+	}
+
+	counts, err := c.db.GetTopCountsForGuildSince(ctx, guildID, since, category, limit, offset)
+	if err != nil {
+		return nil, fmt.Errorf("error getting counts: %s", err)
+	}
+
+	return counts, nil
+}
+
+// GetTopGivers returns a page of the users who gave away the most karma during the current
+// period. Each count is how much the user gave rather than received.
+func (c Core) GetTopGivers(ctx context.Context, guildID string, period Period, limit, offset int) ([]models.RankedCount, error) {
+	since, err := c.periodSince(ctx, guildID, period)
+	if err != nil {
+		return nil, err
+	}
+
+	givers, err := c.db.GetTopGiversForGuildSince(ctx, guildID, since, limit, offset)
+	if err != nil {
+		return nil, fmt.Errorf("error getting givers: %s", err)
+	}
+
+	return givers, nil
+}
+
+// periodSince returns when the current period began for the boards built from the ledger.
+// Closing a season resets every count, so nothing from before the current season counts
+// either, all time included.
+func (c Core) periodSince(ctx context.Context, guildID string, period Period) (int64, error) {
+	var since int64
+	if period != PeriodAllTime && period != "" {
+		since = period.Start(c.now()).Unix()
+	}
+
+	season, err := c.db.GetLatestSeason(ctx, guildID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return since, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("error getting latest season: %s", err)
+	}
+	if season.EndedAt > since {
+		since = season.EndedAt
+	}
+
+	return since, nil
+}
+
+// GetKarmaHistory returns a page of the karma the user has received, newest first
+func (c Core) GetKarmaHistory(ctx context.Context, guildID, userID string, limit, offset int) ([]models.KarmaEvent, error) {
+	evs, err := c.db.GetKarmaEventsForReceiver(ctx, guildID, userID, limit, offset)
+	if err != nil {
+		return nil, fmt.Errorf("error getting events: %s", err)
+	}
+
+	return evs, nil
+}
+
+// GetKarmaEvents returns the guild's most recent karma events, newest first
+func (c Core) GetKarmaEvents(ctx context.Context, guildID string, limit int) ([]models.KarmaEvent, error) {
+	evs, err := c.db.GetKarmaEventsForGuild(ctx, guildID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("error getting events: %s", err)
+	}
+
+	return evs, nil
+}
+
+// CloseSeason ends the guild's current season: every live count is archived into the
+// season's standings and then reset. It returns the closed season and its top counts.
+func (c Core) CloseSeason(ctx context.Context, guildID string, top int) (models.Season, []models.RankedCount, error) {
+	season := models.Season{
+		GuildID: guildID,
+		Number:  1,
+		EndedAt: c.now().Unix(),
+	}
+
+	var standings []models.RankedCount
+	err := c.db.WithTx(ctx, func(tx db.DB) error {
+		prev, err := tx.GetLatestSeason(ctx, guildID)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("error getting previous season: %s", err)
+		}
+		if err == nil {
+			season.Number = prev.Number + 1
+			season.StartedAt = prev.EndedAt
+		}
+
+		season.ID, err = tx.InsertSeason(ctx, season)
+		if err != nil {
+			return fmt.Errorf("error recording season: %s", err)
+		}
+
+		if err := tx.ArchiveCounts(ctx, guildID, season.ID); err != nil {
+			return fmt.Errorf("error archiving counts: %s", err)
+		}
+
+		if err := tx.ResetCounts(ctx, guildID); err != nil {
+			return fmt.Errorf("error resetting counts: %s", err)
+		}
+
+		standings, err = tx.GetSeasonStandings(ctx, season, top)
+		if err != nil {
+			return fmt.Errorf("error getting standings: %s", err)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return models.Season{}, nil, err
+	}
+
+	return season, standings, nil
+}
+
+// GetSeason returns one of the guild's closed seasons and its top counts. A number of
+// zero returns the most recently closed season.
+func (c Core) GetSeason(ctx context.Context, guildID string, number int, top int) (models.Season, []models.RankedCount, error) {
+	var (
+		season models.Season
+		err    error
+	)
+	if number == 0 {
+		season, err = c.db.GetLatestSeason(ctx, guildID)
+	} else {
+		season, err = c.db.GetSeason(ctx, guildID, number)
+	}
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.Season{}, nil, ErrSeasonNotFound
+	}
+	if err != nil {
+		return models.Season{}, nil, fmt.Errorf("error getting season: %s", err)
+	}
+
+	standings, err := c.db.GetSeasonStandings(ctx, season, top)
+	if err != nil {
+		return models.Season{}, nil, fmt.Errorf("error getting standings: %s", err)
+	}
+
+	return season, standings, nil
+}
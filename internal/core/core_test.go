@@ -2,6 +2,7 @@ package core
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"net/url"
@@ -9,8 +10,10 @@ import (
 	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
 	"github.com/jmoiron/sqlx"
 	_ "github.com/mattn/go-sqlite3"
 
@@ -18,6 +21,8 @@ import (
 	"github.com/jdholdren/karma/internal/core/models"
 )
 
+var testNow = time.Date(2023, time.June, 14, 12, 0, 0, 0, time.UTC)
+
 var (
 	sqlxDB *sqlx.DB
 	coreDB coredb.DB
@@ -31,7 +36,7 @@ func removeDB() {
 }
 
 func truncateDB(t *testing.T) {
-	if _, err := sqlxDB.Exec("DELETE FROM karma_counts;"); err != nil {
+	if _, err := sqlxDB.Exec("DELETE FROM karma_counts; DELETE FROM karma_events; DELETE FROM seasons; DELETE FROM season_standings; DELETE FROM karma_audit; DELETE FROM role_rewards; DELETE FROM guild_settings; DELETE FROM guilds; DELETE FROM command_hashes;"); err != nil {
 		t.Fatalf("unexpected error")
 	}
 }
@@ -87,7 +92,8 @@ func TestMain(t *testing.M) {
 	}
 
 	coreDB = coredb.New(sqlxDB)
-	cr = New(coreDB)
+	cr = New(coreDB, Config{})
+	cr.now = func() time.Time { return testNow }
 
 	code := t.Run()
 
@@ -99,12 +105,12 @@ func TestIncrementKarma(t *testing.T) {
 	ctx := context.Background()
 	truncateDB(t)
 
-	_, err := cr.AddKarma(ctx, "guild-1", "user-1")
+	_, err := cr.AddKarma(ctx, models.KarmaEvent{GuildID: "guild-1", GiverID: "user-3", ReceiverID: "user-1", Amount: 1})
 	if err != nil {
 		t.Fatalf("unexpected error: %s", err)
 	}
 
-	_, err = cr.AddKarma(ctx, "guild-1", "user-1")
+	_, err = cr.AddKarma(ctx, models.KarmaEvent{GuildID: "guild-1", GiverID: "user-3", ReceiverID: "user-1", Amount: 1})
 	if err != nil {
 		t.Fatalf("unexpected error: %s", err)
 	}
@@ -128,17 +134,17 @@ func TestTopTen(t *testing.T) {
 	ctx := context.Background()
 	truncateDB(t)
 
-	_, err := cr.AddKarma(ctx, "guild-1", "user-1")
+	_, err := cr.AddKarma(ctx, models.KarmaEvent{GuildID: "guild-1", GiverID: "user-3", ReceiverID: "user-1", Amount: 1})
 	if err != nil {
 		t.Fatalf("unexpected error: %s", err)
 	}
 
-	_, err = cr.AddKarma(ctx, "guild-1", "user-1")
+	_, err = cr.AddKarma(ctx, models.KarmaEvent{GuildID: "guild-1", GiverID: "user-3", ReceiverID: "user-1", Amount: 1})
 	if err != nil {
 		t.Fatalf("unexpected error: %s", err)
 	}
 
-	_, err = cr.AddKarma(ctx, "guild-1", "user-2")
+	_, err = cr.AddKarma(ctx, models.KarmaEvent{GuildID: "guild-1", GiverID: "user-3", ReceiverID: "user-2", Amount: 1})
 	if err != nil {
 		t.Fatalf("unexpected error: %s", err)
 	}
@@ -148,19 +154,1243 @@ func TestTopTen(t *testing.T) {
 		t.Fatalf("unexpected error getting leaderboard: %s", err)
 	}
 
-	want := []models.KarmaCount{
+	want := []models.RankedCount{
 		{
-			UserID:  "user-1",
-			GuildID: "guild-1",
-			Count:   2,
+			KarmaCount: models.KarmaCount{
+				UserID:  "user-1",
+				GuildID: "guild-1",
+				Count:   2,
+			},
+			Rank: 1,
 		},
 		{
-			UserID:  "user-2",
-			GuildID: "guild-1",
-			Count:   1,
+			KarmaCount: models.KarmaCount{
+				UserID:  "user-2",
+				GuildID: "guild-1",
+				Count:   1,
+			},
+			Rank: 2,
 		},
 	}
 	if diff := cmp.Diff(want, got); diff != "" {
 		t.Errorf("GetTopCounts() mismatch (-want +got):\n%s", diff)
 	}
 }
+
+func TestAddKarmaRecordsEvent(t *testing.T) {
+	ctx := context.Background()
+	truncateDB(t)
+
+	_, err := cr.AddKarma(ctx, models.KarmaEvent{
+		GuildID:       "guild-1",
+		GiverID:       "user-2",
+		ReceiverID:    "user-1",
+		Amount:        1,
+		Reason:        "fixing the build",
+		ChannelID:     "channel-1",
+		MessageID:     "message-1",
+		InteractionID: "interaction-1",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	got, err := cr.GetKarmaEvents(ctx, "guild-1", 10)
+	if err != nil {
+		t.Fatalf("unexpected error getting events: %s", err)
+	}
+
+	want := []models.KarmaEvent{
+		{
+			GuildID:       "guild-1",
+			GiverID:       "user-2",
+			ReceiverID:    "user-1",
+			Amount:        1,
+			Reason:        "fixing the build",
+			ChannelID:     "channel-1",
+			MessageID:     "message-1",
+			InteractionID: "interaction-1",
+			CreatedAt:     testNow.Unix(),
+		},
+	}
+	if diff := cmp.Diff(want, got, cmpopts.IgnoreFields(models.KarmaEvent{}, "ID")); diff != "" {
+		t.Errorf("GetKarmaEvents() mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestAddKarmaToSelf(t *testing.T) {
+	ctx := context.Background()
+	truncateDB(t)
+
+	_, err := cr.AddKarma(ctx, models.KarmaEvent{GuildID: "guild-1", GiverID: "user-1", ReceiverID: "user-1", Amount: 1})
+	if !errors.Is(err, ErrSelfKarma) {
+		t.Fatalf("expected ErrSelfKarma, got: %v", err)
+	}
+
+	evs, err := cr.GetKarmaEvents(ctx, "guild-1", 10)
+	if err != nil {
+		t.Fatalf("unexpected error getting events: %s", err)
+	}
+	if len(evs) != 0 {
+		t.Errorf("expected no events to be recorded, got %d", len(evs))
+	}
+}
+
+func TestAddKarmaLimits(t *testing.T) {
+	ctx := context.Background()
+
+	limited := New(coreDB, Config{
+		PairCooldown: time.Hour,
+		DailyBudget:  2,
+	})
+	now := testNow
+	limited.now = func() time.Time { return now }
+
+	tests := []struct {
+		name       string
+		receiverID string
+		at         time.Time
+		wantErr    error
+	}{
+		{
+			name:       "first gift",
+			receiverID: "user-1",
+			at:         testNow,
+		},
+		{
+			name:       "same pair within cooldown",
+			receiverID: "user-1",
+			at:         testNow.Add(30 * time.Minute),
+			wantErr: RateLimitError{
+				Reason:  "changed this user's karma too recently",
+				RetryAt: testNow.Add(time.Hour),
+			},
+		},
+		{
+			name:       "different receiver",
+			receiverID: "user-2",
+			at:         testNow.Add(30 * time.Minute),
+		},
+		{
+			name:       "over daily budget",
+			receiverID: "user-3",
+			at:         testNow.Add(time.Hour),
+			wantErr: RateLimitError{
+				Reason:  "daily karma budget used up",
+				RetryAt: time.Date(2023, time.June, 15, 0, 0, 0, 0, time.UTC),
+			},
+		},
+		{
+			name:       "next day",
+			receiverID: "user-3",
+			at:         testNow.Add(24 * time.Hour),
+		},
+	}
+
+	truncateDB(t)
+	for _, tt := range tests {
+		now = tt.at
+
+		_, err := limited.AddKarma(ctx, models.KarmaEvent{GuildID: "guild-1", GiverID: "user-4", ReceiverID: tt.receiverID, Amount: 1})
+		if diff := cmp.Diff(tt.wantErr, err, cmpopts.EquateErrors()); diff != "" {
+			t.Errorf("%s: AddKarma() error mismatch (-want +got):\n%s", tt.name, diff)
+		}
+	}
+}
+
+func TestRemoveKarma(t *testing.T) {
+	ctx := context.Background()
+
+	tests := []struct {
+		name       string
+		cfg        Config
+		guildID    string
+		wantCount  int
+		wantEvents int
+		wantErr    error
+	}{
+		{
+			name:    "guild not opted in",
+			guildID: "guild-1",
+			wantErr: ErrNegativeKarmaDisabled,
+		},
+		{
+			name: "floored at zero",
+			cfg: Config{
+				NegativeKarmaGuildIDs: []string{"guild-1"},
+			},
+			guildID:    "guild-1",
+			wantCount:  0,
+			wantEvents: 2, // The second yeet took nothing, so it isn't recorded
+		},
+		{
+			name: "negative totals allowed",
+			cfg: Config{
+				NegativeKarmaGuildIDs: []string{"guild-1"},
+				AllowNegativeTotals:   true,
+			},
+			guildID:    "guild-1",
+			wantCount:  -1,
+			wantEvents: 3,
+		},
+	}
+
+	for _, tt := range tests {
+		truncateDB(t)
+		c := New(coreDB, tt.cfg)
+
+		// Start the user at one so the second yeet has to respect the floor
+		if _, err := c.AddKarma(ctx, models.KarmaEvent{GuildID: tt.guildID, GiverID: "user-2", ReceiverID: "user-1", Amount: 1}); err != nil {
+			t.Fatalf("%s: unexpected error adding karma: %s", tt.name, err)
+		}
+
+		var (
+			got models.KarmaChange
+			err error
+		)
+		for j := 0; j < 2; j++ {
+			got, err = c.RemoveKarma(ctx, models.KarmaEvent{GuildID: tt.guildID, GiverID: "user-2", ReceiverID: "user-1", Amount: 1})
+		}
+		if !errors.Is(err, tt.wantErr) {
+			t.Fatalf("%s: RemoveKarma() error = %v, want %v", tt.name, err, tt.wantErr)
+		}
+		if err != nil {
+			continue
+		}
+
+		if got.Count.Count != tt.wantCount {
+			t.Errorf("%s: RemoveKarma() count = %d, want %d", tt.name, got.Count.Count, tt.wantCount)
+		}
+
+		evs, err := c.GetKarmaEvents(ctx, tt.guildID, 10)
+		if err != nil {
+			t.Fatalf("%s: unexpected error getting events: %s", tt.name, err)
+		}
+		if len(evs) != tt.wantEvents {
+			t.Errorf("%s: recorded %d events, want %d", tt.name, len(evs), tt.wantEvents)
+		}
+	}
+}
+
+func TestAddKarmaAmounts(t *testing.T) {
+	ctx := context.Background()
+
+	c := New(coreDB, Config{
+		MaxGiftAmount: 3,
+		GuildMaxGiftAmounts: map[string]int{
+			"guild-2": 10,
+		},
+	})
+
+	tests := []struct {
+		name      string
+		guildID   string
+		amount    int
+		wantCount int
+		wantErr   error
+	}{
+		{
+			name:      "within default max",
+			guildID:   "guild-1",
+			amount:    3,
+			wantCount: 3,
+		},
+		{
+			name:    "over default max",
+			guildID: "guild-1",
+			amount:  4,
+			wantErr: AmountError{Max: 3},
+		},
+		{
+			name:    "zero",
+			guildID: "guild-1",
+			amount:  0,
+			wantErr: AmountError{Max: 3},
+		},
+		{
+			name:      "within guild max",
+			guildID:   "guild-2",
+			amount:    10,
+			wantCount: 10,
+		},
+	}
+
+	for _, tt := range tests {
+		truncateDB(t)
+
+		got, err := c.AddKarma(ctx, models.KarmaEvent{GuildID: tt.guildID, GiverID: "user-2", ReceiverID: "user-1", Amount: tt.amount})
+		if !errors.Is(err, tt.wantErr) {
+			t.Fatalf("%s: AddKarma() error = %v, want %v", tt.name, err, tt.wantErr)
+		}
+		if err != nil {
+			continue
+		}
+
+		if got.Count.Count != tt.wantCount {
+			t.Errorf("%s: AddKarma() count = %d, want %d", tt.name, got.Count.Count, tt.wantCount)
+		}
+	}
+}
+
+func TestUndoGift(t *testing.T) {
+	ctx := context.Background()
+
+	c := New(coreDB, Config{
+		MaxGiftAmount: 5,
+		UndoWindow:    5 * time.Minute,
+	})
+	now := testNow
+	c.now = func() time.Time { return now }
+
+	tests := []struct {
+		name      string
+		giverID   string
+		eventID   func(gift models.KarmaEvent) int64
+		after     time.Duration
+		reset     bool // Have a moderator reset the receiver before the undo
+		wantCount int
+		wantErr   error
+	}{
+		{
+			name:      "most recent gift",
+			giverID:   "user-2",
+			eventID:   func(models.KarmaEvent) int64 { return 0 },
+			after:     time.Minute,
+			wantCount: 1,
+		},
+		{
+			name:      "specific gift",
+			giverID:   "user-2",
+			eventID:   func(gift models.KarmaEvent) int64 { return gift.ID },
+			after:     time.Minute,
+			wantCount: 1,
+		},
+		{
+			name:    "someone else's gift",
+			giverID: "user-3",
+			eventID: func(gift models.KarmaEvent) int64 { return gift.ID },
+			after:   time.Minute,
+			wantErr: ErrNotGiver,
+		},
+		{
+			name:    "nothing to undo",
+			giverID: "user-3",
+			eventID: func(models.KarmaEvent) int64 { return 0 },
+			after:   time.Minute,
+			wantErr: ErrNothingToUndo,
+		},
+		{
+			name:    "outside the window",
+			giverID: "user-2",
+			eventID: func(models.KarmaEvent) int64 { return 0 },
+			after:   10 * time.Minute,
+			wantErr: ErrUndoWindowPassed,
+		},
+		{
+			name:      "count reset since the gift",
+			giverID:   "user-2",
+			eventID:   func(models.KarmaEvent) int64 { return 0 },
+			after:     time.Minute,
+			reset:     true,
+			wantCount: 0,
+		},
+	}
+
+	for _, tt := range tests {
+		truncateDB(t)
+		now = testNow
+
+		if _, err := c.AddKarma(ctx, models.KarmaEvent{GuildID: "guild-1", GiverID: "user-4", ReceiverID: "user-1", Amount: 1}); err != nil {
+			t.Fatalf("%s: unexpected error adding karma: %s", tt.name, err)
+		}
+		gift, err := c.AddKarma(ctx, models.KarmaEvent{GuildID: "guild-1", GiverID: "user-2", ReceiverID: "user-1", Amount: 5})
+		if err != nil {
+			t.Fatalf("%s: unexpected error adding karma: %s", tt.name, err)
+		}
+
+		if tt.reset {
+			if _, err := c.ResetKarma(ctx, "guild-1", "mod-1", "user-1"); err != nil {
+				t.Fatalf("%s: unexpected error resetting karma: %s", tt.name, err)
+			}
+		}
+
+		now = testNow.Add(tt.after)
+		got, err := c.UndoGift(ctx, "guild-1", tt.giverID, tt.eventID(gift.Event))
+		if !errors.Is(err, tt.wantErr) {
+			t.Fatalf("%s: UndoGift() error = %v, want %v", tt.name, err, tt.wantErr)
+		}
+		if err != nil {
+			continue
+		}
+
+		if got.Count.Count != tt.wantCount {
+			t.Errorf("%s: UndoGift() count = %d, want %d", tt.name, got.Count.Count, tt.wantCount)
+		}
+		if got.Event.ID != gift.Event.ID || got.Event.RevokedAt == nil {
+			t.Errorf("%s: UndoGift() expected gift %d to be revoked, got %+v", tt.name, gift.Event.ID, got.Event)
+		}
+
+		// The gift shouldn't be undoable twice
+		if _, err := c.UndoGift(ctx, "guild-1", tt.giverID, gift.Event.ID); !errors.Is(err, ErrNothingToUndo) {
+			t.Errorf("%s: second UndoGift() error = %v, want %v", tt.name, err, ErrNothingToUndo)
+		}
+	}
+}
+
+func TestTopCountsForPeriod(t *testing.T) {
+	ctx := context.Background()
+	truncateDB(t)
+
+	c := New(coreDB, Config{MaxGiftAmount: 5})
+	now := testNow // A Wednesday
+	c.now = func() time.Time { return now }
+
+	gifts := []struct {
+		at         time.Time
+		receiverID string
+		amount     int
+	}{
+		{at: time.Date(2022, time.December, 31, 0, 0, 0, 0, time.UTC), receiverID: "user-1", amount: 5},
+		{at: time.Date(2023, time.May, 31, 0, 0, 0, 0, time.UTC), receiverID: "user-2", amount: 4},
+		{at: time.Date(2023, time.June, 11, 0, 0, 0, 0, time.UTC), receiverID: "user-3", amount: 3},
+		{at: time.Date(2023, time.June, 12, 0, 0, 0, 0, time.UTC), receiverID: "user-4", amount: 2},
+	}
+	for _, g := range gifts {
+		now = g.at
+		if _, err := c.AddKarma(ctx, models.KarmaEvent{GuildID: "guild-1", GiverID: "user-5", ReceiverID: g.receiverID, Amount: g.amount}); err != nil {
+			t.Fatalf("unexpected error adding karma: %s", err)
+		}
+	}
+	now = testNow
+
+	tests := []struct {
+		period Period
+		want   []string
+	}{
+		{period: PeriodWeek, want: []string{"user-4"}},
+		{period: PeriodMonth, want: []string{"user-3", "user-4"}},
+		{period: PeriodYear, want: []string{"user-2", "user-3", "user-4"}},
+		{period: PeriodAllTime, want: []string{"user-1", "user-2", "user-3", "user-4"}},
+	}
+
+	for _, tt := range tests {
+		counts, err := c.GetTopCountsForPeriod(ctx, "guild-1", tt.period, "", 10, 0)
+		if err != nil {
+			t.Fatalf("%s: unexpected error getting leaderboard: %s", tt.period, err)
+		}
+
+		got := make([]string, 0, len(counts))
+		for _, count := range counts {
+			got = append(got, count.UserID)
+		}
+		if diff := cmp.Diff(tt.want, got); diff != "" {
+			t.Errorf("%s: GetTopCountsForPeriod() mismatch (-want +got):\n%s", tt.period, diff)
+		}
+	}
+}
+
+func TestCloseSeason(t *testing.T) {
+	ctx := context.Background()
+	truncateDB(t)
+
+	c := New(coreDB, Config{MaxGiftAmount: 5})
+	now := testNow
+	c.now = func() time.Time { return now }
+
+	for _, receiverID := range []string{"user-1", "user-1", "user-2", "user-4"} {
+		if _, err := c.AddKarma(ctx, models.KarmaEvent{GuildID: "guild-1", GiverID: "user-3", ReceiverID: receiverID, Amount: 1}); err != nil {
+			t.Fatalf("unexpected error adding karma: %s", err)
+		}
+	}
+
+	first, standings, err := c.CloseSeason(ctx, "guild-1", 10)
+	if err != nil {
+		t.Fatalf("unexpected error closing season: %s", err)
+	}
+
+	// Tied users share a place
+	wantStandings := []models.RankedCount{
+		{KarmaCount: models.KarmaCount{GuildID: "guild-1", UserID: "user-1", Count: 2}, Rank: 1},
+		{KarmaCount: models.KarmaCount{GuildID: "guild-1", UserID: "user-2", Count: 1}, Rank: 2},
+		{KarmaCount: models.KarmaCount{GuildID: "guild-1", UserID: "user-4", Count: 1}, Rank: 2},
+	}
+	if diff := cmp.Diff(wantStandings, standings); diff != "" {
+		t.Errorf("CloseSeason() standings mismatch (-want +got):\n%s", diff)
+	}
+
+	// Live counts start over
+	got, err := c.GetKarma(ctx, "guild-1", "user-1")
+	if err != nil {
+		t.Fatalf("unexpected error getting karma: %s", err)
+	}
+	if got.Count != 0 {
+		t.Errorf("GetKarma() after closing season = %d, want 0", got.Count)
+	}
+
+	now = testNow.Add(time.Hour)
+	second, _, err := c.CloseSeason(ctx, "guild-1", 10)
+	if err != nil {
+		t.Fatalf("unexpected error closing second season: %s", err)
+	}
+	wantSeason := models.Season{
+		GuildID:   "guild-1",
+		Number:    2,
+		StartedAt: first.EndedAt,
+		EndedAt:   now.Unix(),
+	}
+	if diff := cmp.Diff(wantSeason, second, cmpopts.IgnoreFields(models.Season{}, "ID")); diff != "" {
+		t.Errorf("CloseSeason() season mismatch (-want +got):\n%s", diff)
+	}
+
+	// The first season is still browsable
+	_, standings, err = c.GetSeason(ctx, "guild-1", 1, 10)
+	if err != nil {
+		t.Fatalf("unexpected error getting season: %s", err)
+	}
+	if diff := cmp.Diff(wantStandings, standings); diff != "" {
+		t.Errorf("GetSeason() standings mismatch (-want +got):\n%s", diff)
+	}
+
+	if _, _, err := c.GetSeason(ctx, "guild-1", 3, 10); !errors.Is(err, ErrSeasonNotFound) {
+		t.Errorf("GetSeason() error = %v, want %v", err, ErrSeasonNotFound)
+	}
+}
+
+func TestCloseSeasonResetsPeriods(t *testing.T) {
+	ctx := context.Background()
+	truncateDB(t)
+
+	c := New(coreDB, Config{MaxGiftAmount: 5, Categories: []string{"helpful"}})
+	now := testNow
+	c.now = func() time.Time { return now }
+
+	if _, err := c.AddKarma(ctx, models.KarmaEvent{GuildID: "guild-1", GiverID: "user-3", ReceiverID: "user-1", Amount: 3, Category: "helpful"}); err != nil {
+		t.Fatalf("unexpected error adding karma: %s", err)
+	}
+
+	now = testNow.Add(time.Minute)
+	if _, _, err := c.CloseSeason(ctx, "guild-1", 10); err != nil {
+		t.Fatalf("unexpected error closing season: %s", err)
+	}
+
+	now = testNow.Add(2 * time.Minute)
+	if _, err := c.AddKarma(ctx, models.KarmaEvent{GuildID: "guild-1", GiverID: "user-4", ReceiverID: "user-2", Amount: 1, Category: "helpful"}); err != nil {
+		t.Fatalf("unexpected error adding karma: %s", err)
+	}
+
+	// Only the gift made since the season closed counts, whatever the period
+	for _, period := range []Period{PeriodWeek, PeriodMonth, PeriodYear, PeriodAllTime} {
+		for _, category := range []string{"", "helpful"} {
+			counts, err := c.GetTopCountsForPeriod(ctx, "guild-1", period, category, 10, 0)
+			if err != nil {
+				t.Fatalf("%s: unexpected error getting leaderboard: %s", period, err)
+			}
+			want := []models.RankedCount{{KarmaCount: models.KarmaCount{GuildID: "guild-1", UserID: "user-2", Count: 1}, Rank: 1}}
+			if diff := cmp.Diff(want, counts); diff != "" {
+				t.Errorf("%s %q: GetTopCountsForPeriod() mismatch (-want +got):\n%s", period, category, diff)
+			}
+		}
+
+		givers, err := c.GetTopGivers(ctx, "guild-1", period, 10, 0)
+		if err != nil {
+			t.Fatalf("%s: unexpected error getting givers: %s", period, err)
+		}
+		want := []models.RankedCount{{KarmaCount: models.KarmaCount{GuildID: "guild-1", UserID: "user-4", Count: 1}, Rank: 1}}
+		if diff := cmp.Diff(want, givers); diff != "" {
+			t.Errorf("%s: GetTopGivers() mismatch (-want +got):\n%s", period, diff)
+		}
+	}
+
+	breakdown, err := c.GetCategoryCounts(ctx, "guild-1", "user-1")
+	if err != nil {
+		t.Fatalf("unexpected error getting category counts: %s", err)
+	}
+	if len(breakdown) != 0 {
+		t.Errorf("GetCategoryCounts() after closing season = %+v, want none", breakdown)
+	}
+}
+
+func TestTopCountsPagination(t *testing.T) {
+	ctx := context.Background()
+	truncateDB(t)
+
+	c := New(coreDB, Config{MaxGiftAmount: 5})
+	for j := 1; j <= 5; j++ {
+		receiverID := fmt.Sprintf("user-%d", j)
+		if _, err := c.AddKarma(ctx, models.KarmaEvent{GuildID: "guild-1", GiverID: "user-6", ReceiverID: receiverID, Amount: j}); err != nil {
+			t.Fatalf("unexpected error adding karma: %s", err)
+		}
+	}
+
+	for _, period := range []Period{PeriodAllTime, PeriodWeek} {
+		var got []string
+		for offset := 0; offset < 6; offset += 2 {
+			counts, err := c.GetTopCountsForPeriod(ctx, "guild-1", period, "", 2, offset)
+			if err != nil {
+				t.Fatalf("%s: unexpected error getting leaderboard: %s", period, err)
+			}
+			if len(counts) > 2 {
+				t.Fatalf("%s: GetTopCountsForPeriod() returned %d counts, want at most 2", period, len(counts))
+			}
+
+			for _, count := range counts {
+				got = append(got, count.UserID)
+			}
+		}
+
+		want := []string{"user-5", "user-4", "user-3", "user-2", "user-1"}
+		if diff := cmp.Diff(want, got); diff != "" {
+			t.Errorf("%s: paging through GetTopCountsForPeriod() mismatch (-want +got):\n%s", period, diff)
+		}
+	}
+}
+
+func TestGetRank(t *testing.T) {
+	ctx := context.Background()
+	truncateDB(t)
+
+	c := New(coreDB, Config{MaxGiftAmount: 10})
+	amounts := map[string]int{
+		"user-1": 10,
+		"user-2": 8,
+		"user-3": 8,
+		"user-4": 5,
+		"user-5": 3,
+		"user-6": 1,
+	}
+	for receiverID, amount := range amounts {
+		if _, err := c.AddKarma(ctx, models.KarmaEvent{GuildID: "guild-1", GiverID: "user-7", ReceiverID: receiverID, Amount: amount}); err != nil {
+			t.Fatalf("unexpected error adding karma: %s", err)
+		}
+	}
+
+	ranked := func(userID string, count, rank int) models.RankedCount {
+		return models.RankedCount{
+			KarmaCount: models.KarmaCount{GuildID: "guild-1", UserID: userID, Count: count},
+			Rank:       rank,
+		}
+	}
+
+	tests := []struct {
+		userID  string
+		want    []models.RankedCount
+		wantErr error
+	}{
+		{
+			userID: "user-1",
+			want: []models.RankedCount{
+				ranked("user-1", 10, 1),
+				ranked("user-2", 8, 2),
+				ranked("user-3", 8, 2),
+			},
+		},
+		{
+			userID: "user-4",
+			want: []models.RankedCount{
+				ranked("user-2", 8, 2),
+				ranked("user-3", 8, 2),
+				ranked("user-4", 5, 3),
+				ranked("user-5", 3, 4),
+				ranked("user-6", 1, 5),
+			},
+		},
+		{
+			userID:  "user-8",
+			wantErr: ErrNotRanked,
+		},
+	}
+
+	for _, tt := range tests {
+		got, err := c.GetRank(ctx, "guild-1", tt.userID, 2)
+		if !errors.Is(err, tt.wantErr) {
+			t.Fatalf("%s: GetRank() error = %v, want %v", tt.userID, err, tt.wantErr)
+		}
+
+		if diff := cmp.Diff(tt.want, got); diff != "" {
+			t.Errorf("%s: GetRank() mismatch (-want +got):\n%s", tt.userID, diff)
+		}
+	}
+}
+
+func TestGetKarmaHistory(t *testing.T) {
+	ctx := context.Background()
+	truncateDB(t)
+
+	c := New(coreDB, Config{UndoWindow: time.Minute})
+	now := testNow
+	c.now = func() time.Time { return now }
+
+	gifts := []models.KarmaEvent{
+		{GuildID: "guild-1", GiverID: "user-2", ReceiverID: "user-1", Amount: 1, Reason: "first"},
+		{GuildID: "guild-1", GiverID: "user-3", ReceiverID: "user-1", Amount: 1, Reason: "second"},
+		{GuildID: "guild-1", GiverID: "user-1", ReceiverID: "user-2", Amount: 1, Reason: "someone else"},
+		{GuildID: "guild-1", GiverID: "user-4", ReceiverID: "user-1", Amount: 1, Reason: "third"},
+		{GuildID: "guild-1", GiverID: "user-5", ReceiverID: "user-1", Amount: 1, Reason: "undone"},
+	}
+	for j, gift := range gifts {
+		now = testNow.Add(time.Duration(j) * time.Second)
+		if _, err := c.AddKarma(ctx, gift); err != nil {
+			t.Fatalf("unexpected error adding karma: %s", err)
+		}
+	}
+	if _, err := c.UndoGift(ctx, "guild-1", "user-5", 0); err != nil {
+		t.Fatalf("unexpected error undoing gift: %s", err)
+	}
+
+	var got []string
+	for offset := 0; offset < 4; offset += 2 {
+		evs, err := c.GetKarmaHistory(ctx, "guild-1", "user-1", 2, offset)
+		if err != nil {
+			t.Fatalf("unexpected error getting history: %s", err)
+		}
+
+		for _, ev := range evs {
+			got = append(got, ev.Reason)
+		}
+	}
+
+	want := []string{"third", "second", "first"}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("GetKarmaHistory() mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestGetTopGivers(t *testing.T) {
+	ctx := context.Background()
+	truncateDB(t)
+
+	c := New(coreDB, Config{
+		MaxGiftAmount:         5,
+		NegativeKarmaGuildIDs: []string{"guild-1"},
+	})
+	now := testNow
+	c.now = func() time.Time { return now }
+
+	// Last year's gifts only count all-time
+	now = time.Date(2022, time.December, 31, 0, 0, 0, 0, time.UTC)
+	if _, err := c.AddKarma(ctx, models.KarmaEvent{GuildID: "guild-1", GiverID: "user-3", ReceiverID: "user-1", Amount: 5}); err != nil {
+		t.Fatalf("unexpected error adding karma: %s", err)
+	}
+
+	now = testNow
+	gifts := []models.KarmaEvent{
+		{GuildID: "guild-1", GiverID: "user-1", ReceiverID: "user-4", Amount: 3},
+		{GuildID: "guild-1", GiverID: "user-2", ReceiverID: "user-4", Amount: 2},
+		{GuildID: "guild-1", GiverID: "user-2", ReceiverID: "user-5", Amount: 1},
+	}
+	for _, gift := range gifts {
+		if _, err := c.AddKarma(ctx, gift); err != nil {
+			t.Fatalf("unexpected error adding karma: %s", err)
+		}
+	}
+	// Taking karma away isn't generous
+	if _, err := c.RemoveKarma(ctx, models.KarmaEvent{GuildID: "guild-1", GiverID: "user-3", ReceiverID: "user-4"}); err != nil {
+		t.Fatalf("unexpected error removing karma: %s", err)
+	}
+
+	ranked := func(userID string, count, rank int) models.RankedCount {
+		return models.RankedCount{
+			KarmaCount: models.KarmaCount{GuildID: "guild-1", UserID: userID, Count: count},
+			Rank:       rank,
+		}
+	}
+
+	tests := []struct {
+		period Period
+		want   []models.RankedCount
+	}{
+		{
+			period: PeriodYear,
+			want: []models.RankedCount{
+				ranked("user-1", 3, 1),
+				ranked("user-2", 3, 1),
+			},
+		},
+		{
+			period: PeriodAllTime,
+			want: []models.RankedCount{
+				ranked("user-3", 5, 1),
+				ranked("user-1", 3, 2),
+				ranked("user-2", 3, 2),
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		got, err := c.GetTopGivers(ctx, "guild-1", tt.period, 10, 0)
+		if err != nil {
+			t.Fatalf("%s: unexpected error getting givers: %s", tt.period, err)
+		}
+
+		if diff := cmp.Diff(tt.want, got); diff != "" {
+			t.Errorf("%s: GetTopGivers() mismatch (-want +got):\n%s", tt.period, diff)
+		}
+	}
+}
+
+func TestKarmaCategories(t *testing.T) {
+	ctx := context.Background()
+	truncateDB(t)
+
+	c := New(coreDB, Config{
+		MaxGiftAmount: 5,
+		Categories:    []string{"helpful", "funny"},
+		GuildCategories: map[string][]string{
+			"guild-2": {"mentor"},
+		},
+	})
+
+	gifts := []models.KarmaEvent{
+		{GuildID: "guild-1", GiverID: "user-3", ReceiverID: "user-1", Amount: 2, Category: "helpful"},
+		{GuildID: "guild-1", GiverID: "user-3", ReceiverID: "user-1", Amount: 1, Category: "funny"},
+		{GuildID: "guild-1", GiverID: "user-3", ReceiverID: "user-1", Amount: 1},
+		{GuildID: "guild-1", GiverID: "user-3", ReceiverID: "user-2", Amount: 3, Category: "funny"},
+	}
+	for _, gift := range gifts {
+		if _, err := c.AddKarma(ctx, gift); err != nil {
+			t.Fatalf("unexpected error adding karma: %s", err)
+		}
+	}
+
+	_, err := c.AddKarma(ctx, models.KarmaEvent{GuildID: "guild-2", GiverID: "user-3", ReceiverID: "user-1", Amount: 1, Category: "helpful"})
+	if !errors.Is(err, ErrUnknownCategory) {
+		t.Errorf("AddKarma() with another guild's category error = %v, want %v", err, ErrUnknownCategory)
+	}
+
+	breakdown, err := c.GetCategoryCounts(ctx, "guild-1", "user-1")
+	if err != nil {
+		t.Fatalf("unexpected error getting category counts: %s", err)
+	}
+	wantBreakdown := []models.CategoryCount{
+		{Category: "helpful", Count: 2},
+		{Category: "", Count: 1},
+		{Category: "funny", Count: 1},
+	}
+	if diff := cmp.Diff(wantBreakdown, breakdown); diff != "" {
+		t.Errorf("GetCategoryCounts() mismatch (-want +got):\n%s", diff)
+	}
+
+	counts, err := c.GetTopCountsForPeriod(ctx, "guild-1", PeriodAllTime, "funny", 10, 0)
+	if err != nil {
+		t.Fatalf("unexpected error getting leaderboard: %s", err)
+	}
+	var got []string
+	for _, count := range counts {
+		got = append(got, fmt.Sprintf("%s:%d", count.UserID, count.Count))
+	}
+	if diff := cmp.Diff([]string{"user-2:3", "user-1:1"}, got); diff != "" {
+		t.Errorf("GetTopCountsForPeriod() for category mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestAddKarmaToMany(t *testing.T) {
+	ctx := context.Background()
+	truncateDB(t)
+
+	c := New(coreDB, Config{
+		MaxGiftAmount: 5,
+		DailyBudget:   4,
+	})
+
+	gift := func(receiverID string) models.KarmaEvent {
+		return models.KarmaEvent{GuildID: "guild-1", GiverID: "user-4", ReceiverID: receiverID, Amount: 1}
+	}
+
+	changes, err := c.AddKarmaToMany(ctx, []models.KarmaEvent{gift("user-1"), gift("user-2"), gift("user-3")})
+	if err != nil {
+		t.Fatalf("unexpected error adding karma: %s", err)
+	}
+
+	var got []string
+	for _, change := range changes {
+		got = append(got, fmt.Sprintf("%s:%d", change.Count.UserID, change.Count.Count))
+	}
+	if diff := cmp.Diff([]string{"user-1:1", "user-2:1", "user-3:1"}, got); diff != "" {
+		t.Errorf("AddKarmaToMany() mismatch (-want +got):\n%s", diff)
+	}
+
+	// Going over the budget partway through means none of the gifts happen
+	_, err = c.AddKarmaToMany(ctx, []models.KarmaEvent{gift("user-5"), gift("user-6")})
+	var rle RateLimitError
+	if !errors.As(err, &rle) {
+		t.Fatalf("AddKarmaToMany() error = %v, want a RateLimitError", err)
+	}
+
+	count, err := c.GetKarma(ctx, "guild-1", "user-5")
+	if err != nil {
+		t.Fatalf("unexpected error getting karma: %s", err)
+	}
+	if count.Count != 0 {
+		t.Errorf("GetKarma() after a failed AddKarmaToMany() = %d, want 0", count.Count)
+	}
+}
+
+func TestAdminKarma(t *testing.T) {
+	ctx := context.Background()
+	truncateDB(t)
+
+	for _, receiver := range []string{"user-1", "user-1", "user-2"} {
+		if _, err := cr.AddKarma(ctx, models.KarmaEvent{GuildID: "guild-1", GiverID: "user-3", ReceiverID: receiver, Amount: 1}); err != nil {
+			t.Fatalf("unexpected error adding karma: %s", err)
+		}
+	}
+	// The two accounts have given each other karma too
+	for _, pair := range [][2]string{{"user-1", "user-2"}, {"user-2", "user-1"}} {
+		if _, err := cr.AddKarma(ctx, models.KarmaEvent{GuildID: "guild-1", GiverID: pair[0], ReceiverID: pair[1], Amount: 1}); err != nil {
+			t.Fatalf("unexpected error adding karma: %s", err)
+		}
+	}
+
+	count, err := cr.SetKarma(ctx, "guild-1", "mod-1", "user-1", 10)
+	if err != nil {
+		t.Fatalf("unexpected error setting karma: %s", err)
+	}
+	if count.Count != 10 {
+		t.Errorf("SetKarma() = %d, want 10", count.Count)
+	}
+
+	count, err = cr.AdjustKarma(ctx, "guild-1", "mod-1", "user-1", -3)
+	if err != nil {
+		t.Fatalf("unexpected error adjusting karma: %s", err)
+	}
+	if count.Count != 7 {
+		t.Errorf("AdjustKarma() = %d, want 7", count.Count)
+	}
+
+	// The old account's count and history end up on the new one
+	count, err = cr.TransferKarma(ctx, "guild-1", "mod-1", "user-1", "user-2")
+	if err != nil {
+		t.Fatalf("unexpected error transferring karma: %s", err)
+	}
+	if count.Count != 9 {
+		t.Errorf("TransferKarma() = %d, want 9", count.Count)
+	}
+	history, err := cr.GetKarmaHistory(ctx, "guild-1", "user-2", 10, 0)
+	if err != nil {
+		t.Fatalf("unexpected error getting history: %s", err)
+	}
+	if len(history) != 4 {
+		t.Errorf("GetKarmaHistory() after transfer returned %d events, want 4", len(history))
+	}
+	for _, ev := range history {
+		if ev.GiverID == ev.ReceiverID {
+			t.Errorf("GetKarmaHistory() after transfer has a gift to oneself: %+v", ev)
+		}
+	}
+	givers, err := cr.GetTopGivers(ctx, "guild-1", PeriodAllTime, 10, 0)
+	if err != nil {
+		t.Fatalf("unexpected error getting givers: %s", err)
+	}
+	for _, giver := range givers {
+		if giver.UserID == "user-2" && giver.Count != 1 {
+			t.Errorf("GetTopGivers() after transfer has user-2 giving %d, want 1", giver.Count)
+		}
+	}
+	old, err := cr.GetKarma(ctx, "guild-1", "user-1")
+	if err != nil {
+		t.Fatalf("unexpected error getting karma: %s", err)
+	}
+	if old.Count != 0 {
+		t.Errorf("GetKarma() of the old account = %d, want 0", old.Count)
+	}
+
+	if _, err := cr.TransferKarma(ctx, "guild-1", "mod-1", "user-2", "user-2"); !errors.Is(err, ErrSameUser) {
+		t.Errorf("TransferKarma() to self error = %v, want ErrSameUser", err)
+	}
+
+	if _, err := cr.ResetKarma(ctx, "guild-1", "mod-2", "user-2"); err != nil {
+		t.Fatalf("unexpected error resetting karma: %s", err)
+	}
+
+	entries, err := cr.GetAuditLog(ctx, "guild-1", 10)
+	if err != nil {
+		t.Fatalf("unexpected error getting audit log: %s", err)
+	}
+	var got []string
+	for _, e := range entries {
+		got = append(got, fmt.Sprintf("%s %s %s%s %d->%d", e.ModeratorID, e.Action, e.UserID, e.TargetUserID, e.OldCount, e.NewCount))
+	}
+	want := []string{
+		"mod-2 reset user-2 9->0",
+		"mod-1 transfer user-1user-2 7->9",
+		"mod-1 adjust user-1 10->7",
+		"mod-1 set user-1 3->10",
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("GetAuditLog() mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestRoleRewards(t *testing.T) {
+	ctx := context.Background()
+	truncateDB(t)
+
+	c := New(coreDB, Config{MaxGiftAmount: 10})
+
+	for threshold, roleID := range map[int]string{3: "role-3", 5: "role-5", 20: "role-20"} {
+		if err := c.SetRoleReward(ctx, "guild-1", threshold, roleID); err != nil {
+			t.Fatalf("unexpected error setting reward: %s", err)
+		}
+	}
+	if err := c.SetRoleReward(ctx, "guild-2", 1, "other-guild"); err != nil {
+		t.Fatalf("unexpected error setting reward: %s", err)
+	}
+
+	gift := func(amount int) []string {
+		t.Helper()
+
+		change, err := c.AddKarma(ctx, models.KarmaEvent{GuildID: "guild-1", GiverID: "user-2", ReceiverID: "user-1", Amount: amount})
+		if err != nil {
+			t.Fatalf("unexpected error adding karma: %s", err)
+		}
+
+		var roles []string
+		for _, reward := range change.Rewards {
+			roles = append(roles, reward.RoleID)
+		}
+		return roles
+	}
+
+	if got := gift(2); len(got) != 0 {
+		t.Errorf("rewards below the first threshold = %v, want none", got)
+	}
+	// One gift can pass several thresholds at once
+	if diff := cmp.Diff([]string{"role-3", "role-5"}, gift(4)); diff != "" {
+		t.Errorf("rewards mismatch (-want +got):\n%s", diff)
+	}
+	if got := gift(1); len(got) != 0 {
+		t.Errorf("rewards after passing thresholds = %v, want none", got)
+	}
+
+	if err := c.RemoveRoleReward(ctx, "guild-1", 4); !errors.Is(err, ErrRewardNotFound) {
+		t.Errorf("RemoveRoleReward() error = %v, want ErrRewardNotFound", err)
+	}
+	if err := c.RemoveRoleReward(ctx, "guild-1", 20); err != nil {
+		t.Fatalf("unexpected error removing reward: %s", err)
+	}
+	rewards, err := c.GetRoleRewards(ctx, "guild-1")
+	if err != nil {
+		t.Fatalf("unexpected error getting rewards: %s", err)
+	}
+	want := []models.RoleReward{
+		{GuildID: "guild-1", Threshold: 3, RoleID: "role-3"},
+		{GuildID: "guild-1", Threshold: 5, RoleID: "role-5"},
+	}
+	if diff := cmp.Diff(want, rewards); diff != "" {
+		t.Errorf("GetRoleRewards() mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestTookFirstPlace(t *testing.T) {
+	ctx := context.Background()
+	truncateDB(t)
+
+	c := New(coreDB, Config{MaxGiftAmount: 5})
+
+	gift := func(receiverID string, amount int) bool {
+		t.Helper()
+
+		change, err := c.AddKarma(ctx, models.KarmaEvent{GuildID: "guild-1", GiverID: "user-9", ReceiverID: receiverID, Amount: amount})
+		if err != nil {
+			t.Fatalf("unexpected error adding karma: %s", err)
+		}
+		return change.TookFirstPlace
+	}
+
+	if gift("user-1", 2) {
+		t.Errorf("TookFirstPlace with nobody to overtake, want false")
+	}
+	if gift("user-2", 2) {
+		t.Errorf("TookFirstPlace after tying the leader, want false")
+	}
+	if !gift("user-2", 1) {
+		t.Errorf("TookFirstPlace after overtaking the leader is false, want true")
+	}
+	if gift("user-2", 1) {
+		t.Errorf("TookFirstPlace while already in first, want false")
+	}
+}
+
+func TestGuildSettings(t *testing.T) {
+	ctx := context.Background()
+	truncateDB(t)
+
+	c := New(coreDB, Config{
+		MaxGiftAmount:       3,
+		GuildMaxGiftAmounts: map[string]int{"guild-2": 5},
+		UndoWindow:          5 * time.Minute,
+	})
+
+	// The defaults come from the config
+	gs, err := c.GuildSettings(ctx, "guild-2")
+	if err != nil {
+		t.Fatalf("unexpected error getting settings: %s", err)
+	}
+	if gs.MaxGiftAmount != 5 || gs.UndoWindow != 5*time.Minute {
+		t.Errorf("GuildSettings() = %+v, want the config's defaults", gs)
+	}
+
+	if _, err := c.SetGuildSetting(ctx, "guild-1", "max_amount", "zero"); !errors.As(err, new(SettingError)) {
+		t.Errorf("SetGuildSetting() with a bad value error = %v, want a SettingError", err)
+	}
+	if _, err := c.SetGuildSetting(ctx, "guild-1", "nope", "1"); !errors.Is(err, ErrUnknownSetting) {
+		t.Errorf("SetGuildSetting() with a bad key error = %v, want ErrUnknownSetting", err)
+	}
+
+	if _, err := c.SetGuildSetting(ctx, "guild-1", "max_amount", "10"); err != nil {
+		t.Fatalf("unexpected error setting max_amount: %s", err)
+	}
+	if _, err := c.SetGuildSetting(ctx, "guild-1", "categories", "helpful, funny,helpful"); err != nil {
+		t.Fatalf("unexpected error setting categories: %s", err)
+	}
+	if _, err := c.SetGuildSetting(ctx, "guild-1", "announce_channel", "<#1234>"); err != nil {
+		t.Fatalf("unexpected error setting announce_channel: %s", err)
+	}
+
+	gs, err = c.GuildSettings(ctx, "guild-1")
+	if err != nil {
+		t.Fatalf("unexpected error getting settings: %s", err)
+	}
+	want := GuildSettings{
+		MaxGiftAmount:     10,
+		UndoWindow:        5 * time.Minute,
+		Categories:        []string{"helpful", "funny"},
+		AnnounceChannelID: "1234",
+	}
+	if diff := cmp.Diff(want, gs); diff != "" {
+		t.Errorf("GuildSettings() mismatch (-want +got):\n%s", diff)
+	}
+
+	// Gifts follow the guild's settings rather than the config
+	_, err = c.AddKarma(ctx, models.KarmaEvent{GuildID: "guild-1", GiverID: "user-1", ReceiverID: "user-2", Amount: 10, Category: "funny"})
+	if err != nil {
+		t.Fatalf("unexpected error adding karma: %s", err)
+	}
+
+	gs, err = c.ResetGuildSetting(ctx, "guild-1", "max_amount")
+	if err != nil {
+		t.Fatalf("unexpected error resetting max_amount: %s", err)
+	}
+	if gs.MaxGiftAmount != 3 {
+		t.Errorf("MaxGiftAmount after reset = %d, want 3", gs.MaxGiftAmount)
+	}
+}
+
+func TestAddGuild(t *testing.T) {
+	ctx := context.Background()
+	truncateDB(t)
+
+	for _, want := range []bool{true, false} {
+		added, err := cr.AddGuild(ctx, "guild-1")
+		if err != nil {
+			t.Fatalf("unexpected error adding guild: %s", err)
+		}
+		if added != want {
+			t.Errorf("AddGuild() = %t, want %t", added, want)
+		}
+	}
+
+	for guildID, want := range map[string]bool{"guild-1": true, "guild-2": false} {
+		known, err := cr.IsKnownGuild(ctx, guildID)
+		if err != nil {
+			t.Fatalf("unexpected error checking guild: %s", err)
+		}
+		if known != want {
+			t.Errorf("IsKnownGuild(%s) = %t, want %t", guildID, known, want)
+		}
+	}
+
+	ids, err := cr.GetGuildIDs(ctx)
+	if err != nil {
+		t.Fatalf("unexpected error getting guilds: %s", err)
+	}
+	if diff := cmp.Diff([]string{"guild-1"}, ids); diff != "" {
+		t.Errorf("GetGuildIDs() mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestCommandHash(t *testing.T) {
+	ctx := context.Background()
+	truncateDB(t)
+
+	hash, err := cr.GetCommandHash(ctx, "guild-1")
+	if err != nil {
+		t.Fatalf("unexpected error getting hash: %s", err)
+	}
+	if hash != "" {
+		t.Errorf("GetCommandHash() before a sync = %q, want empty", hash)
+	}
+
+	for _, want := range []string{"abc", "def"} {
+		if err := cr.SetCommandHash(ctx, "guild-1", want); err != nil {
+			t.Fatalf("unexpected error setting hash: %s", err)
+		}
+
+		hash, err := cr.GetCommandHash(ctx, "guild-1")
+		if err != nil {
+			t.Fatalf("unexpected error getting hash: %s", err)
+		}
+		if hash != want {
+			t.Errorf("GetCommandHash() = %q, want %q", hash, want)
+		}
+	}
+}
+
+func TestExportImport(t *testing.T) {
+	ctx := context.Background()
+	truncateDB(t)
+
+	for _, receiver := range []string{"user-1", "user-2", "user-1"} {
+		if _, err := cr.AddKarma(ctx, models.KarmaEvent{GuildID: "guild-1", GiverID: "user-3", ReceiverID: receiver, Amount: 1}); err != nil {
+			t.Fatalf("unexpected error adding karma: %s", err)
+		}
+	}
+	if _, _, err := cr.CloseSeason(ctx, "guild-1", 10); err != nil {
+		t.Fatalf("unexpected error closing season: %s", err)
+	}
+	if _, err := cr.AddKarma(ctx, models.KarmaEvent{GuildID: "guild-1", GiverID: "user-1", ReceiverID: "user-2", Amount: 1, Reason: "thanks"}); err != nil {
+		t.Fatalf("unexpected error adding karma: %s", err)
+	}
+	if _, err := cr.SetGuildSetting(ctx, "guild-1", "undo_window", "1m"); err != nil {
+		t.Fatalf("unexpected error setting undo_window: %s", err)
+	}
+	if err := cr.SetRoleReward(ctx, "guild-1", 10, "role-1"); err != nil {
+		t.Fatalf("unexpected error setting reward: %s", err)
+	}
+
+	exp, err := cr.Export(ctx, "guild-1")
+	if err != nil {
+		t.Fatalf("unexpected error exporting: %s", err)
+	}
+
+	// Importing over the guild replaces rather than duplicates, and another guild gets a copy
+	if err := cr.Import(ctx, exp); err != nil {
+		t.Fatalf("unexpected error importing: %s", err)
+	}
+	exp.GuildID = "guild-2"
+	if err := cr.Import(ctx, exp); err != nil {
+		t.Fatalf("unexpected error importing into another guild: %s", err)
+	}
+
+	ignoreGuild := cmp.Options{
+		cmpopts.IgnoreFields(models.KarmaCount{}, "GuildID"),
+		cmpopts.IgnoreFields(models.KarmaEvent{}, "ID", "GuildID"),
+		cmpopts.IgnoreFields(models.Season{}, "ID", "GuildID"),
+		cmpopts.IgnoreFields(models.GuildSetting{}, "GuildID"),
+		cmpopts.IgnoreFields(models.RoleReward{}, "GuildID"),
+		cmpopts.IgnoreFields(models.GuildExport{}, "GuildID"),
+	}
+	for _, guildID := range []string{"guild-1", "guild-2"} {
+		got, err := cr.Export(ctx, guildID)
+		if err != nil {
+			t.Fatalf("unexpected error exporting: %s", err)
+		}
+		if diff := cmp.Diff(exp, got, ignoreGuild); diff != "" {
+			t.Errorf("Export(%s) after Import() mismatch (-want +got):\n%s", guildID, diff)
+		}
+	}
+
+	if err := cr.Import(ctx, models.GuildExport{}); !errors.Is(err, ErrNoGuild) {
+		t.Errorf("Import() without a guild error = %v, want ErrNoGuild", err)
+	}
+}
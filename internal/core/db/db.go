@@ -2,6 +2,7 @@ package db
 
 import (
 	"context"
+	"database/sql"
 	"fmt"
 
 	"github.com/jdholdren/karma/internal/core/models"
@@ -12,48 +13,737 @@ import (
 // persistent storage
 type DB struct {
 	db *sqlx.DB
+	tx *sqlx.Tx // Set when the DB is bound to a transaction by WithTx
+
+	ext sqlx.ExtContext // What queries are run against: either db or tx
 }
 
 // New creates an instance of our repository using the provided connection
 func New(db *sqlx.DB) DB {
 	return DB{
-		db: db,
+		db:  db,
+		ext: db,
 	}
 }
 
-func (db DB) IncrementCount(ctx context.Context, guildID, userID string) error {
+// WithTx runs fn with a DB bound to a single transaction. The transaction is committed
+// if fn returns nil and rolled back otherwise. Calling WithTx on a DB that's already in a
+// transaction just reuses it.
+func (db DB) WithTx(ctx context.Context, fn func(DB) error) error {
+	if db.tx != nil {
+		return fn(db)
+	}
+
+	tx, err := db.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("error beginning transaction: %s", err)
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	if err := fn(DB{db: db.db, tx: tx, ext: tx}); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error committing transaction: %s", err)
+	}
+
+	return nil
+}
+
+// IncrementCount adds the amount to the user's karma
+func (db DB) IncrementCount(ctx context.Context, guildID, userID string, amount int) error {
 	q := `
-	INSERT INTO karma_counts(guild_id, user_id, count) VALUES (?, ?, 1) ON CONFLICT(guild_id, user_id) DO UPDATE SET count=count+1;
+	INSERT INTO karma_counts(guild_id, user_id, count) VALUES (?, ?, ?) ON CONFLICT(guild_id, user_id) DO UPDATE SET count=count+excluded.count;
 	`
-	if _, err := db.db.ExecContext(ctx, q, guildID, userID); err != nil {
+	if _, err := db.ext.ExecContext(ctx, q, guildID, userID, amount); err != nil {
 		return fmt.Errorf("error incrementing karma_count: %s", err)
 	}
 
 	return nil
 }
 
+// DecrementCount takes one karma from the user. If floorAtZero is set, the count won't go below zero.
+func (db DB) DecrementCount(ctx context.Context, guildID, userID string, floorAtZero bool) error {
+	q := `
+	INSERT INTO karma_counts(guild_id, user_id, count) VALUES (?, ?, CASE WHEN ? THEN 0 ELSE -1 END)
+	ON CONFLICT(guild_id, user_id) DO UPDATE SET count=CASE WHEN ? THEN MAX(count-1, 0) ELSE count-1 END;
+	`
+	if _, err := db.ext.ExecContext(ctx, q, guildID, userID, floorAtZero, floorAtZero); err != nil {
+		return fmt.Errorf("error decrementing karma_count: %s", err)
+	}
+
+	return nil
+}
+
+// SetCount overwrites the user's karma
+func (db DB) SetCount(ctx context.Context, guildID, userID string, count int) error {
+	q := `
+	INSERT INTO karma_counts(guild_id, user_id, count) VALUES (?, ?, ?) ON CONFLICT(guild_id, user_id) DO UPDATE SET count=excluded.count;
+	`
+	if _, err := db.ext.ExecContext(ctx, q, guildID, userID, count); err != nil {
+		return fmt.Errorf("error setting karma_count: %s", err)
+	}
+
+	return nil
+}
+
+// DeleteCount removes the user's count entirely
+func (db DB) DeleteCount(ctx context.Context, guildID, userID string) error {
+	q := `
+	DELETE FROM karma_counts WHERE guild_id = ? AND user_id = ?;
+	`
+	if _, err := db.ext.ExecContext(ctx, q, guildID, userID); err != nil {
+		return fmt.Errorf("error deleting karma_count: %s", err)
+	}
+
+	return nil
+}
+
 func (db DB) GetKarmaCount(ctx context.Context, guildID, userID string) (models.KarmaCount, error) {
 	q := `
 	SELECT * FROM karma_counts WHERE guild_id = ? AND user_id = ? LIMIT 1;
 	`
 
 	kc := models.KarmaCount{}
-	if err := db.db.GetContext(ctx, &kc, q, guildID, userID); err != nil {
-		return models.KarmaCount{}, fmt.Errorf("error retrieving karma_count: %s", err)
+	if err := sqlx.GetContext(ctx, db.ext, &kc, q, guildID, userID); err != nil {
+		return models.KarmaCount{}, fmt.Errorf("error retrieving karma_count: %w", err)
 	}
 
 	return kc, nil
 }
 
-func (db DB) GetTopCountsForGuild(ctx context.Context, guildID string, top int) ([]models.KarmaCount, error) {
+// GetTopCountsForGuild returns a page of the guild's highest counts
+func (db DB) GetTopCountsForGuild(ctx context.Context, guildID string, limit, offset int) ([]models.RankedCount, error) {
 	q := `
-	SELECT * FROM karma_counts WHERE guild_id = ? ORDER BY count DESC;
+	SELECT guild_id, user_id, count, DENSE_RANK() OVER (ORDER BY count DESC) AS rank
+	FROM karma_counts WHERE guild_id = ? ORDER BY count DESC, user_id LIMIT ? OFFSET ?;
 	`
 
-	kcs := make([]models.KarmaCount, 0, top)
-	if err := db.db.SelectContext(ctx, &kcs, q, guildID); err != nil {
+	kcs := make([]models.RankedCount, 0, limit)
+	if err := sqlx.SelectContext(ctx, db.ext, &kcs, q, guildID, limit, offset); err != nil {
 		return nil, fmt.Errorf("error retrieving counts: %s", err)
 	}
 
 	return kcs, nil
 }
+
+// GetHighestCountExcept returns the highest count in the guild among everyone but the user.
+// It's not valid if nobody else has a count.
+func (db DB) GetHighestCountExcept(ctx context.Context, guildID, userID string) (sql.NullInt64, error) {
+	q := `
+	SELECT MAX(count) FROM karma_counts WHERE guild_id = ? AND user_id != ?;
+	`
+
+	var highest sql.NullInt64
+	if err := sqlx.GetContext(ctx, db.ext, &highest, q, guildID, userID); err != nil {
+		return sql.NullInt64{}, fmt.Errorf("error retrieving highest count: %s", err)
+	}
+
+	return highest, nil
+}
+
+// GetTopCountsForGuildSince totals the karma each user received since the given time from the
+// ledger, rather than the running counts, and returns a page of the highest. Revoked events
+// are left out, as are events outside the category if one is given.
+func (db DB) GetTopCountsForGuildSince(ctx context.Context, guildID string, since int64, category string, limit, offset int) ([]models.RankedCount, error) {
+	q := `
+	SELECT guild_id, receiver_id AS user_id, SUM(amount) AS count, DENSE_RANK() OVER (ORDER BY SUM(amount) DESC) AS rank
+	FROM karma_events
+	WHERE guild_id = ? AND created_at >= ? AND revoked_at IS NULL AND (? = '' OR category = ?)
+	GROUP BY guild_id, receiver_id HAVING SUM(amount) > 0
+	ORDER BY count DESC, user_id LIMIT ? OFFSET ?;
+	`
+
+	kcs := make([]models.RankedCount, 0, limit)
+	if err := sqlx.SelectContext(ctx, db.ext, &kcs, q, guildID, since, category, category, limit, offset); err != nil {
+		return nil, fmt.Errorf("error retrieving counts: %s", err)
+	}
+
+	return kcs, nil
+}
+
+// GetCategoryCounts totals the karma the user received in each category since the given
+// time, largest first. Revoked events are left out.
+func (db DB) GetCategoryCounts(ctx context.Context, guildID, userID string, since int64) ([]models.CategoryCount, error) {
+	q := `
+	SELECT category, SUM(amount) AS count FROM karma_events
+	WHERE guild_id = ? AND receiver_id = ? AND created_at >= ? AND revoked_at IS NULL
+	GROUP BY category ORDER BY count DESC, category;
+	`
+
+	ccs := []models.CategoryCount{}
+	if err := sqlx.SelectContext(ctx, db.ext, &ccs, q, guildID, userID, since); err != nil {
+		return nil, fmt.Errorf("error retrieving category counts: %s", err)
+	}
+
+	return ccs, nil
+}
+
+// GetTopGiversForGuildSince totals the karma each user gave away since the given time and
+// returns a page of the most generous. Karma taken away and revoked gifts are left out.
+func (db DB) GetTopGiversForGuildSince(ctx context.Context, guildID string, since int64, limit, offset int) ([]models.RankedCount, error) {
+	q := `
+	SELECT guild_id, giver_id AS user_id, SUM(amount) AS count, DENSE_RANK() OVER (ORDER BY SUM(amount) DESC) AS rank
+	FROM karma_events
+	WHERE guild_id = ? AND created_at >= ? AND amount > 0 AND revoked_at IS NULL AND giver_id != ''
+	GROUP BY guild_id, giver_id
+	ORDER BY count DESC, user_id LIMIT ? OFFSET ?;
+	`
+
+	kcs := make([]models.RankedCount, 0, limit)
+	if err := sqlx.SelectContext(ctx, db.ext, &kcs, q, guildID, since, limit, offset); err != nil {
+		return nil, fmt.Errorf("error retrieving givers: %s", err)
+	}
+
+	return kcs, nil
+}
+
+// GetRankedCountsAround returns the user's ranked count along with up to `around` of the
+// counts directly above and below them on the leaderboard. It's empty if the user has no count.
+func (db DB) GetRankedCountsAround(ctx context.Context, guildID, userID string, around int) ([]models.RankedCount, error) {
+	q := `
+	WITH ranked AS (
+		SELECT guild_id, user_id, count,
+			DENSE_RANK() OVER (ORDER BY count DESC) AS rank,
+			ROW_NUMBER() OVER (ORDER BY count DESC, user_id) AS position
+		FROM karma_counts WHERE guild_id = ?
+	), target AS (
+		SELECT position FROM ranked WHERE user_id = ?
+	)
+	SELECT guild_id, user_id, count, rank FROM ranked, target
+	WHERE ranked.position BETWEEN target.position - ? AND target.position + ?
+	ORDER BY ranked.position;
+	`
+
+	kcs := make([]models.RankedCount, 0, 2*around+1)
+	if err := sqlx.SelectContext(ctx, db.ext, &kcs, q, guildID, userID, around, around); err != nil {
+		return nil, fmt.Errorf("error retrieving counts: %s", err)
+	}
+
+	return kcs, nil
+}
+
+// InsertKarmaEvent appends an event to the karma ledger and returns its ID
+func (db DB) InsertKarmaEvent(ctx context.Context, ev models.KarmaEvent) (int64, error) {
+	q := `
+	INSERT INTO karma_events(guild_id, giver_id, receiver_id, amount, reason, channel_id, message_id, interaction_id, category, created_at)
+	VALUES (:guild_id, :giver_id, :receiver_id, :amount, :reason, :channel_id, :message_id, :interaction_id, :category, :created_at);
+	`
+	res, err := sqlx.NamedExecContext(ctx, db.ext, q, ev)
+	if err != nil {
+		return 0, fmt.Errorf("error inserting karma_event: %s", err)
+	}
+
+	id, err := res.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("error getting karma_event id: %s", err)
+	}
+
+	return id, nil
+}
+
+// GetKarmaEventsForGuild returns the most recent events in the guild's ledger, newest first
+func (db DB) GetKarmaEventsForGuild(ctx context.Context, guildID string, limit int) ([]models.KarmaEvent, error) {
+	q := `
+	SELECT * FROM karma_events WHERE guild_id = ? ORDER BY created_at DESC, id DESC LIMIT ?;
+	`
+
+	evs := make([]models.KarmaEvent, 0, limit)
+	if err := sqlx.SelectContext(ctx, db.ext, &evs, q, guildID, limit); err != nil {
+		return nil, fmt.Errorf("error retrieving karma_events: %s", err)
+	}
+
+	return evs, nil
+}
+
+// GetKarmaEventsForReceiver returns a page of the events where the user received karma, newest
+// first. Revoked events are left out.
+func (db DB) GetKarmaEventsForReceiver(ctx context.Context, guildID, receiverID string, limit, offset int) ([]models.KarmaEvent, error) {
+	q := `
+	SELECT * FROM karma_events WHERE guild_id = ? AND receiver_id = ? AND revoked_at IS NULL
+	ORDER BY created_at DESC, id DESC LIMIT ? OFFSET ?;
+	`
+
+	evs := make([]models.KarmaEvent, 0, limit)
+	if err := sqlx.SelectContext(ctx, db.ext, &evs, q, guildID, receiverID, limit, offset); err != nil {
+		return nil, fmt.Errorf("error retrieving karma_events: %s", err)
+	}
+
+	return evs, nil
+}
+
+// GetLastGiftTime returns when the giver last gave the receiver karma, or zero if they never have
+func (db DB) GetLastGiftTime(ctx context.Context, guildID, giverID, receiverID string) (int64, error) {
+	q := `
+	SELECT COALESCE(MAX(created_at), 0) FROM karma_events
+	WHERE guild_id = ? AND giver_id = ? AND receiver_id = ? AND revoked_at IS NULL;
+	`
+
+	var last int64
+	if err := sqlx.GetContext(ctx, db.ext, &last, q, guildID, giverID, receiverID); err != nil {
+		return 0, fmt.Errorf("error retrieving last gift time: %s", err)
+	}
+
+	return last, nil
+}
+
+// GetAmountGivenSince totals how much karma the giver has handed out since the given time.
+// Karma taken away doesn't count against what's been given.
+func (db DB) GetAmountGivenSince(ctx context.Context, guildID, giverID string, since int64) (int, error) {
+	q := `
+	SELECT COALESCE(SUM(amount), 0) FROM karma_events
+	WHERE guild_id = ? AND giver_id = ? AND created_at >= ? AND amount > 0 AND revoked_at IS NULL;
+	`
+
+	var total int
+	if err := sqlx.GetContext(ctx, db.ext, &total, q, guildID, giverID, since); err != nil {
+		return 0, fmt.Errorf("error retrieving amount given: %s", err)
+	}
+
+	return total, nil
+}
+
+// GetKarmaEvent retrieves a single event from the guild's ledger
+func (db DB) GetKarmaEvent(ctx context.Context, guildID string, id int64) (models.KarmaEvent, error) {
+	q := `
+	SELECT * FROM karma_events WHERE guild_id = ? AND id = ? LIMIT 1;
+	`
+
+	ev := models.KarmaEvent{}
+	if err := sqlx.GetContext(ctx, db.ext, &ev, q, guildID, id); err != nil {
+		return models.KarmaEvent{}, fmt.Errorf("error retrieving karma_event: %w", err)
+	}
+
+	return ev, nil
+}
+
+// GetLastGiftByGiver retrieves the most recent gift the giver made that hasn't been revoked
+func (db DB) GetLastGiftByGiver(ctx context.Context, guildID, giverID string) (models.KarmaEvent, error) {
+	q := `
+	SELECT * FROM karma_events
+	WHERE guild_id = ? AND giver_id = ? AND amount > 0 AND revoked_at IS NULL
+	ORDER BY created_at DESC, id DESC LIMIT 1;
+	`
+
+	ev := models.KarmaEvent{}
+	if err := sqlx.GetContext(ctx, db.ext, &ev, q, guildID, giverID); err != nil {
+		return models.KarmaEvent{}, fmt.Errorf("error retrieving karma_event: %w", err)
+	}
+
+	return ev, nil
+}
+
+// RevokeKarmaEvent marks the event as revoked. The event stays in the ledger.
+func (db DB) RevokeKarmaEvent(ctx context.Context, id int64, at int64) error {
+	q := `
+	UPDATE karma_events SET revoked_at = ? WHERE id = ?;
+	`
+	if _, err := db.ext.ExecContext(ctx, q, at, id); err != nil {
+		return fmt.Errorf("error revoking karma_event: %s", err)
+	}
+
+	return nil
+}
+
+// GetLatestSeason retrieves the guild's most recently closed season
+func (db DB) GetLatestSeason(ctx context.Context, guildID string) (models.Season, error) {
+	q := `
+	SELECT * FROM seasons WHERE guild_id = ? ORDER BY number DESC LIMIT 1;
+	`
+
+	season := models.Season{}
+	if err := sqlx.GetContext(ctx, db.ext, &season, q, guildID); err != nil {
+		return models.Season{}, fmt.Errorf("error retrieving season: %w", err)
+	}
+
+	return season, nil
+}
+
+// GetSeason retrieves one of the guild's seasons by its number
+func (db DB) GetSeason(ctx context.Context, guildID string, number int) (models.Season, error) {
+	q := `
+	SELECT * FROM seasons WHERE guild_id = ? AND number = ? LIMIT 1;
+	`
+
+	season := models.Season{}
+	if err := sqlx.GetContext(ctx, db.ext, &season, q, guildID, number); err != nil {
+		return models.Season{}, fmt.Errorf("error retrieving season: %w", err)
+	}
+
+	return season, nil
+}
+
+// InsertSeason records a closed season and returns its ID
+func (db DB) InsertSeason(ctx context.Context, season models.Season) (int64, error) {
+	q := `
+	INSERT INTO seasons(guild_id, number, started_at, ended_at) VALUES (:guild_id, :number, :started_at, :ended_at);
+	`
+	res, err := sqlx.NamedExecContext(ctx, db.ext, q, season)
+	if err != nil {
+		return 0, fmt.Errorf("error inserting season: %s", err)
+	}
+
+	id, err := res.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("error getting season id: %s", err)
+	}
+
+	return id, nil
+}
+
+// ArchiveCounts copies every one of the guild's live counts into the season's standings
+func (db DB) ArchiveCounts(ctx context.Context, guildID string, seasonID int64) error {
+	q := `
+	INSERT INTO season_standings(season_id, user_id, count) SELECT ?, user_id, count FROM karma_counts WHERE guild_id = ?;
+	`
+	if _, err := db.ext.ExecContext(ctx, q, seasonID, guildID); err != nil {
+		return fmt.Errorf("error archiving karma_counts: %s", err)
+	}
+
+	return nil
+}
+
+// ResetCounts removes all of the guild's live counts
+func (db DB) ResetCounts(ctx context.Context, guildID string) error {
+	q := `
+	DELETE FROM karma_counts WHERE guild_id = ?;
+	`
+	if _, err := db.ext.ExecContext(ctx, q, guildID); err != nil {
+		return fmt.Errorf("error resetting karma_counts: %s", err)
+	}
+
+	return nil
+}
+
+// GetSeasonStandings returns the season's highest archived counts, ranked the same way as
+// the leaderboard
+func (db DB) GetSeasonStandings(ctx context.Context, season models.Season, top int) ([]models.RankedCount, error) {
+	q := `
+	SELECT ? AS guild_id, user_id, count, DENSE_RANK() OVER (ORDER BY count DESC) AS rank
+	FROM season_standings WHERE season_id = ? ORDER BY count DESC, user_id LIMIT ?;
+	`
+
+	kcs := make([]models.RankedCount, 0, top)
+	if err := sqlx.SelectContext(ctx, db.ext, &kcs, q, season.GuildID, season.ID, top); err != nil {
+		return nil, fmt.Errorf("error retrieving season_standings: %s", err)
+	}
+
+	return kcs, nil
+}
+
+// ReassignKarmaEvents moves every event given or received by one user over to another. Events
+// between the two users are left as they were, since they'd become gifts to oneself.
+func (db DB) ReassignKarmaEvents(ctx context.Context, guildID, fromID, toID string) error {
+	qs := []string{
+		`UPDATE karma_events SET receiver_id = ? WHERE guild_id = ? AND receiver_id = ? AND giver_id != ?;`,
+		`UPDATE karma_events SET giver_id = ? WHERE guild_id = ? AND giver_id = ? AND receiver_id != ?;`,
+	}
+	for _, q := range qs {
+		if _, err := db.ext.ExecContext(ctx, q, toID, guildID, fromID, toID); err != nil {
+			return fmt.Errorf("error reassigning karma_events: %s", err)
+		}
+	}
+
+	return nil
+}
+
+// InsertAuditEntry records a moderator's change to the audit log
+func (db DB) InsertAuditEntry(ctx context.Context, entry models.AuditEntry) error {
+	q := `
+	INSERT INTO karma_audit(guild_id, moderator_id, action, user_id, target_user_id, old_count, new_count, created_at)
+	VALUES (:guild_id, :moderator_id, :action, :user_id, :target_user_id, :old_count, :new_count, :created_at);
+	`
+	if _, err := sqlx.NamedExecContext(ctx, db.ext, q, entry); err != nil {
+		return fmt.Errorf("error inserting karma_audit: %s", err)
+	}
+
+	return nil
+}
+
+// GetAuditEntries returns the guild's most recent audit log entries, newest first
+func (db DB) GetAuditEntries(ctx context.Context, guildID string, limit int) ([]models.AuditEntry, error) {
+	q := `
+	SELECT * FROM karma_audit WHERE guild_id = ? ORDER BY created_at DESC, id DESC LIMIT ?;
+	`
+
+	entries := make([]models.AuditEntry, 0, limit)
+	if err := sqlx.SelectContext(ctx, db.ext, &entries, q, guildID, limit); err != nil {
+		return nil, fmt.Errorf("error retrieving karma_audit: %s", err)
+	}
+
+	return entries, nil
+}
+
+// UpsertRoleReward sets the role given at the reward's threshold
+func (db DB) UpsertRoleReward(ctx context.Context, reward models.RoleReward) error {
+	q := `
+	INSERT INTO role_rewards(guild_id, threshold, role_id) VALUES (:guild_id, :threshold, :role_id)
+	ON CONFLICT(guild_id, threshold) DO UPDATE SET role_id=excluded.role_id;
+	`
+	if _, err := sqlx.NamedExecContext(ctx, db.ext, q, reward); err != nil {
+		return fmt.Errorf("error upserting role_reward: %s", err)
+	}
+
+	return nil
+}
+
+// DeleteRoleReward removes the reward at the threshold, returning if there was one
+func (db DB) DeleteRoleReward(ctx context.Context, guildID string, threshold int) (bool, error) {
+	q := `
+	DELETE FROM role_rewards WHERE guild_id = ? AND threshold = ?;
+	`
+	res, err := db.ext.ExecContext(ctx, q, guildID, threshold)
+	if err != nil {
+		return false, fmt.Errorf("error deleting role_reward: %s", err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("error getting rows affected: %s", err)
+	}
+
+	return n > 0, nil
+}
+
+// GetRoleRewards returns the guild's rewards, lowest threshold first
+func (db DB) GetRoleRewards(ctx context.Context, guildID string) ([]models.RoleReward, error) {
+	q := `
+	SELECT * FROM role_rewards WHERE guild_id = ? ORDER BY threshold ASC;
+	`
+
+	var rewards []models.RoleReward
+	if err := sqlx.SelectContext(ctx, db.ext, &rewards, q, guildID); err != nil {
+		return nil, fmt.Errorf("error retrieving role_rewards: %s", err)
+	}
+
+	return rewards, nil
+}
+
+// GetRoleRewardsBetween returns the guild's rewards with a threshold above from and at most to
+func (db DB) GetRoleRewardsBetween(ctx context.Context, guildID string, from, to int) ([]models.RoleReward, error) {
+	q := `
+	SELECT * FROM role_rewards WHERE guild_id = ? AND threshold > ? AND threshold <= ? ORDER BY threshold ASC;
+	`
+
+	var rewards []models.RoleReward
+	if err := sqlx.SelectContext(ctx, db.ext, &rewards, q, guildID, from, to); err != nil {
+		return nil, fmt.Errorf("error retrieving role_rewards: %s", err)
+	}
+
+	return rewards, nil
+}
+
+// GetGuildSettings returns the settings the guild has changed from the defaults
+func (db DB) GetGuildSettings(ctx context.Context, guildID string) ([]models.GuildSetting, error) {
+	q := `
+	SELECT * FROM guild_settings WHERE guild_id = ?;
+	`
+
+	var settings []models.GuildSetting
+	if err := sqlx.SelectContext(ctx, db.ext, &settings, q, guildID); err != nil {
+		return nil, fmt.Errorf("error retrieving guild_settings: %s", err)
+	}
+
+	return settings, nil
+}
+
+// UpsertGuildSetting stores the guild's value for a setting
+func (db DB) UpsertGuildSetting(ctx context.Context, setting models.GuildSetting) error {
+	q := `
+	INSERT INTO guild_settings(guild_id, key, value) VALUES (:guild_id, :key, :value)
+	ON CONFLICT(guild_id, key) DO UPDATE SET value=excluded.value;
+	`
+	if _, err := sqlx.NamedExecContext(ctx, db.ext, q, setting); err != nil {
+		return fmt.Errorf("error upserting guild_setting: %s", err)
+	}
+
+	return nil
+}
+
+// DeleteGuildSetting removes the guild's value for a setting so the default applies again
+func (db DB) DeleteGuildSetting(ctx context.Context, guildID, key string) error {
+	q := `
+	DELETE FROM guild_settings WHERE guild_id = ? AND key = ?;
+	`
+	if _, err := db.ext.ExecContext(ctx, q, guildID, key); err != nil {
+		return fmt.Errorf("error deleting guild_setting: %s", err)
+	}
+
+	return nil
+}
+
+// InsertGuild records the guild as one the app serves, returning false if it already was
+func (db DB) InsertGuild(ctx context.Context, guildID string, at int64) (bool, error) {
+	q := `
+	INSERT INTO guilds(guild_id, added_at) VALUES (?, ?) ON CONFLICT(guild_id) DO NOTHING;
+	`
+	res, err := db.ext.ExecContext(ctx, q, guildID, at)
+	if err != nil {
+		return false, fmt.Errorf("error inserting guild: %s", err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("error getting rows affected: %s", err)
+	}
+
+	return n > 0, nil
+}
+
+// GetGuildIDs returns every guild the app has been added to
+func (db DB) GetGuildIDs(ctx context.Context) ([]string, error) {
+	q := `
+	SELECT guild_id FROM guilds ORDER BY added_at, guild_id;
+	`
+
+	var ids []string
+	if err := sqlx.SelectContext(ctx, db.ext, &ids, q); err != nil {
+		return nil, fmt.Errorf("error retrieving guilds: %s", err)
+	}
+
+	return ids, nil
+}
+
+// GuildExists reports if the guild has been recorded
+func (db DB) GuildExists(ctx context.Context, guildID string) (bool, error) {
+	q := `
+	SELECT EXISTS(SELECT 1 FROM guilds WHERE guild_id = ?);
+	`
+
+	var exists bool
+	if err := sqlx.GetContext(ctx, db.ext, &exists, q, guildID); err != nil {
+		return false, fmt.Errorf("error checking guild: %s", err)
+	}
+
+	return exists, nil
+}
+
+// GetCommandHash returns the hash of the commands last synced to the guild
+func (db DB) GetCommandHash(ctx context.Context, guildID string) (string, error) {
+	q := `
+	SELECT hash FROM command_hashes WHERE guild_id = ?;
+	`
+
+	var hash string
+	if err := sqlx.GetContext(ctx, db.ext, &hash, q, guildID); err != nil {
+		return "", fmt.Errorf("error retrieving command_hash: %w", err)
+	}
+
+	return hash, nil
+}
+
+// UpsertCommandHash records the hash of the commands just synced to the guild
+func (db DB) UpsertCommandHash(ctx context.Context, guildID, hash string, at int64) error {
+	q := `
+	INSERT INTO command_hashes(guild_id, hash, synced_at) VALUES (?, ?, ?)
+	ON CONFLICT(guild_id) DO UPDATE SET hash=excluded.hash, synced_at=excluded.synced_at;
+	`
+	if _, err := db.ext.ExecContext(ctx, q, guildID, hash, at); err != nil {
+		return fmt.Errorf("error upserting command_hash: %s", err)
+	}
+
+	return nil
+}
+
+// GetAllCounts returns every count in the guild
+func (db DB) GetAllCounts(ctx context.Context, guildID string) ([]models.KarmaCount, error) {
+	q := `
+	SELECT * FROM karma_counts WHERE guild_id = ? ORDER BY user_id;
+	`
+
+	var kcs []models.KarmaCount
+	if err := sqlx.SelectContext(ctx, db.ext, &kcs, q, guildID); err != nil {
+		return nil, fmt.Errorf("error retrieving karma_counts: %s", err)
+	}
+
+	return kcs, nil
+}
+
+// GetAllKarmaEvents returns the guild's whole ledger, oldest first, including revoked events
+func (db DB) GetAllKarmaEvents(ctx context.Context, guildID string) ([]models.KarmaEvent, error) {
+	q := `
+	SELECT * FROM karma_events WHERE guild_id = ? ORDER BY id;
+	`
+
+	var evs []models.KarmaEvent
+	if err := sqlx.SelectContext(ctx, db.ext, &evs, q, guildID); err != nil {
+		return nil, fmt.Errorf("error retrieving karma_events: %s", err)
+	}
+
+	return evs, nil
+}
+
+// GetSeasons returns every season the guild has closed, first to last
+func (db DB) GetSeasons(ctx context.Context, guildID string) ([]models.Season, error) {
+	q := `
+	SELECT * FROM seasons WHERE guild_id = ? ORDER BY number;
+	`
+
+	var seasons []models.Season
+	if err := sqlx.SelectContext(ctx, db.ext, &seasons, q, guildID); err != nil {
+		return nil, fmt.Errorf("error retrieving seasons: %s", err)
+	}
+
+	return seasons, nil
+}
+
+// GetAllSeasonStandings returns everyone's final count for the season
+func (db DB) GetAllSeasonStandings(ctx context.Context, season models.Season) ([]models.KarmaCount, error) {
+	q := `
+	SELECT ? AS guild_id, user_id, count FROM season_standings WHERE season_id = ? ORDER BY count DESC, user_id;
+	`
+
+	var kcs []models.KarmaCount
+	if err := sqlx.SelectContext(ctx, db.ext, &kcs, q, season.GuildID, season.ID); err != nil {
+		return nil, fmt.Errorf("error retrieving season_standings: %s", err)
+	}
+
+	return kcs, nil
+}
+
+// InsertSeasonStanding records a user's final count for a season
+func (db DB) InsertSeasonStanding(ctx context.Context, seasonID int64, count models.KarmaCount) error {
+	q := `
+	INSERT INTO season_standings(season_id, user_id, count) VALUES (?, ?, ?);
+	`
+	if _, err := db.ext.ExecContext(ctx, q, seasonID, count.UserID, count.Count); err != nil {
+		return fmt.Errorf("error inserting season_standing: %s", err)
+	}
+
+	return nil
+}
+
+// ImportKarmaEvent adds an event to the ledger as it was, revoked or not. It gets a new id.
+func (db DB) ImportKarmaEvent(ctx context.Context, ev models.KarmaEvent) error {
+	q := `
+	INSERT INTO karma_events(guild_id, giver_id, receiver_id, amount, reason, channel_id, message_id, interaction_id, category, created_at, revoked_at)
+	VALUES (:guild_id, :giver_id, :receiver_id, :amount, :reason, :channel_id, :message_id, :interaction_id, :category, :created_at, :revoked_at);
+	`
+	if _, err := sqlx.NamedExecContext(ctx, db.ext, q, ev); err != nil {
+		return fmt.Errorf("error importing karma_event: %s", err)
+	}
+
+	return nil
+}
+
+// DeleteGuildData removes the guild's counts, ledger, seasons, settings and rewards
+func (db DB) DeleteGuildData(ctx context.Context, guildID string) error {
+	qs := []string{
+		`DELETE FROM season_standings WHERE season_id IN (SELECT id FROM seasons WHERE guild_id = ?);`,
+		`DELETE FROM seasons WHERE guild_id = ?;`,
+		`DELETE FROM karma_counts WHERE guild_id = ?;`,
+		`DELETE FROM karma_events WHERE guild_id = ?;`,
+		`DELETE FROM guild_settings WHERE guild_id = ?;`,
+		`DELETE FROM role_rewards WHERE guild_id = ?;`,
+	}
+	for _, q := range qs {
+		if _, err := db.ext.ExecContext(ctx, q, guildID); err != nil {
+			return fmt.Errorf("error deleting guild data: %s", err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,112 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jdholdren/karma/internal/core/db"
+	"github.com/jdholdren/karma/internal/core/models"
+)
+
+// ErrNoGuild is returned when importing an export that doesn't say which guild it's for
+var ErrNoGuild = errors.New("export has no guild")
+
+// Export gathers everything about karma in the guild: counts, the ledger, past seasons,
+// settings and rewards. The audit log isn't included.
+func (c Core) Export(ctx context.Context, guildID string) (models.GuildExport, error) {
+	exp := models.GuildExport{GuildID: guildID}
+	err := c.db.WithTx(ctx, func(tx db.DB) error {
+		var err error
+		if exp.Counts, err = tx.GetAllCounts(ctx, guildID); err != nil {
+			return err
+		}
+		if exp.Events, err = tx.GetAllKarmaEvents(ctx, guildID); err != nil {
+			return err
+		}
+		if exp.Settings, err = tx.GetGuildSettings(ctx, guildID); err != nil {
+			return err
+		}
+		if exp.RoleRewards, err = tx.GetRoleRewards(ctx, guildID); err != nil {
+			return err
+		}
+
+		seasons, err := tx.GetSeasons(ctx, guildID)
+		if err != nil {
+			return err
+		}
+		for _, season := range seasons {
+			standings, err := tx.GetAllSeasonStandings(ctx, season)
+			if err != nil {
+				return err
+			}
+
+			exp.Seasons = append(exp.Seasons, models.SeasonExport{Season: season, Standings: standings})
+		}
+
+		return nil
+	})
+	if err != nil {
+		return models.GuildExport{}, fmt.Errorf("error exporting guild: %s", err)
+	}
+
+	return exp, nil
+}
+
+// Import replaces everything about karma in the export's guild with what's in the export,
+// in a single transaction. Events and seasons get new ids.
+func (c Core) Import(ctx context.Context, exp models.GuildExport) error {
+	if exp.GuildID == "" {
+		return ErrNoGuild
+	}
+
+	err := c.db.WithTx(ctx, func(tx db.DB) error {
+		if err := tx.DeleteGuildData(ctx, exp.GuildID); err != nil {
+			return err
+		}
+
+		for _, count := range exp.Counts {
+			if err := tx.SetCount(ctx, exp.GuildID, count.UserID, count.Count); err != nil {
+				return err
+			}
+		}
+		for _, ev := range exp.Events {
+			ev.GuildID = exp.GuildID
+			if err := tx.ImportKarmaEvent(ctx, ev); err != nil {
+				return err
+			}
+		}
+		for _, setting := range exp.Settings {
+			setting.GuildID = exp.GuildID
+			if err := tx.UpsertGuildSetting(ctx, setting); err != nil {
+				return err
+			}
+		}
+		for _, reward := range exp.RoleRewards {
+			reward.GuildID = exp.GuildID
+			if err := tx.UpsertRoleReward(ctx, reward); err != nil {
+				return err
+			}
+		}
+		for _, season := range exp.Seasons {
+			season.GuildID = exp.GuildID
+			id, err := tx.InsertSeason(ctx, season.Season)
+			if err != nil {
+				return err
+			}
+
+			for _, count := range season.Standings {
+				if err := tx.InsertSeasonStanding(ctx, id, count); err != nil {
+					return err
+				}
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("error importing guild: %s", err)
+	}
+
+	return nil
+}
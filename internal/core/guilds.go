@@ -0,0 +1,62 @@
+package core
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+)
+
+// AddGuild records that the app has been added to the guild. It returns false if the guild
+// was already known.
+func (c Core) AddGuild(ctx context.Context, guildID string) (bool, error) {
+	added, err := c.db.InsertGuild(ctx, guildID, c.now().Unix())
+	if err != nil {
+		return false, fmt.Errorf("error adding guild: %s", err)
+	}
+
+	return added, nil
+}
+
+// GetGuildIDs returns every guild the app has been added to
+func (c Core) GetGuildIDs(ctx context.Context) ([]string, error) {
+	ids, err := c.db.GetGuildIDs(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error getting guilds: %s", err)
+	}
+
+	return ids, nil
+}
+
+// IsKnownGuild reports if the app has been added to the guild
+func (c Core) IsKnownGuild(ctx context.Context, guildID string) (bool, error) {
+	known, err := c.db.GuildExists(ctx, guildID)
+	if err != nil {
+		return false, fmt.Errorf("error checking guild: %s", err)
+	}
+
+	return known, nil
+}
+
+// GetCommandHash returns the hash of the commands last synced to the guild, empty if
+// they never have been
+func (c Core) GetCommandHash(ctx context.Context, guildID string) (string, error) {
+	hash, err := c.db.GetCommandHash(ctx, guildID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("error getting command hash: %s", err)
+	}
+
+	return hash, nil
+}
+
+// SetCommandHash records the hash of the commands just synced to the guild
+func (c Core) SetCommandHash(ctx context.Context, guildID, hash string) error {
+	if err := c.db.UpsertCommandHash(ctx, guildID, hash, c.now().Unix()); err != nil {
+		return fmt.Errorf("error setting command hash: %s", err)
+	}
+
+	return nil
+}
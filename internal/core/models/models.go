@@ -7,5 +7,100 @@ package models
 type KarmaCount struct {
 	GuildID string `db:"guild_id"`
 	UserID  string `db:"user_id"`
-	Count   uint   `db:"count"`
+	Count   int    `db:"count"`
+}
+
+// A RankedCount is a KarmaCount with its place on the leaderboard. Ranks are dense:
+// users with the same count share a rank and the next count down gets the next rank.
+type RankedCount struct {
+	KarmaCount
+	Rank int `db:"rank"`
+}
+
+// A KarmaEvent is a single entry in the karma ledger: one user giving
+// another some amount of karma
+type KarmaEvent struct {
+	ID            int64  `db:"id"`
+	GuildID       string `db:"guild_id"`
+	GiverID       string `db:"giver_id"`
+	ReceiverID    string `db:"receiver_id"`
+	Amount        int    `db:"amount"` // Negative when karma was taken away
+	Reason        string `db:"reason"`
+	ChannelID     string `db:"channel_id"`
+	MessageID     string `db:"message_id"` // Set when karma was given for a specific message
+	InteractionID string `db:"interaction_id"`
+	Category      string `db:"category"`   // Empty if the giver didn't pick one
+	CreatedAt     int64  `db:"created_at"` // Unix seconds
+	RevokedAt     *int64 `db:"revoked_at"` // Unix seconds, nil unless the event was undone
+}
+
+// A KarmaChange is the result of applying a KarmaEvent: the event as recorded
+// and the receiver's count afterward
+type KarmaChange struct {
+	Event KarmaEvent
+	Count KarmaCount
+
+	// The rewards whose thresholds the receiver passed with this change
+	Rewards []RoleReward
+	// If the change moved the receiver ahead of everyone else on the leaderboard
+	TookFirstPlace bool
+}
+
+// A Season is a closed stretch of time in a guild whose final counts were archived
+// before the live counts were reset
+type Season struct {
+	ID        int64  `db:"id"`
+	GuildID   string `db:"guild_id"`
+	Number    int    `db:"number"`     // Starts at one for each guild
+	StartedAt int64  `db:"started_at"` // Unix seconds, zero for a guild's first season
+	EndedAt   int64  `db:"ended_at"`   // Unix seconds
+}
+
+// A CategoryCount is how much karma a user received in a single category
+type CategoryCount struct {
+	Category string `db:"category"`
+	Count    int    `db:"count"`
+}
+
+// An AuditEntry records a moderator changing someone's count directly
+type AuditEntry struct {
+	ID           int64  `db:"id"`
+	GuildID      string `db:"guild_id"`
+	ModeratorID  string `db:"moderator_id"`
+	Action       string `db:"action"`
+	UserID       string `db:"user_id"`
+	TargetUserID string `db:"target_user_id"` // Where the count went for transfers, otherwise empty
+	OldCount     int    `db:"old_count"`      // The user's count before the change
+	NewCount     int    `db:"new_count"`      // The user's count after, or the target's for transfers
+	CreatedAt    int64  `db:"created_at"`     // Unix seconds
+}
+
+// A RoleReward is a role the guild hands out once someone's karma reaches the threshold
+type RoleReward struct {
+	GuildID   string `db:"guild_id"`
+	Threshold int    `db:"threshold"`
+	RoleID    string `db:"role_id"`
+}
+
+// A GuildSetting is a guild's choice for one of its settings, stored as text
+type GuildSetting struct {
+	GuildID string `db:"guild_id"`
+	Key     string `db:"key"`
+	Value   string `db:"value"`
+}
+
+// A GuildExport is everything about karma in a guild, for moving it between databases
+type GuildExport struct {
+	GuildID     string
+	Counts      []KarmaCount
+	Events      []KarmaEvent
+	Seasons     []SeasonExport
+	Settings    []GuildSetting
+	RoleRewards []RoleReward
+}
+
+// A SeasonExport is a closed season with everyone's final count
+type SeasonExport struct {
+	Season
+	Standings []KarmaCount
 }
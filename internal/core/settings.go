@@ -0,0 +1,316 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jdholdren/karma/internal/core/models"
+)
+
+// GuildSettings are the choices a guild has made about how karma works there. Anything a
+// guild hasn't changed comes from the Config.
+type GuildSettings struct {
+	// How long a giver has to wait before giving the same receiver karma again
+	PairCooldown time.Duration
+	// How much karma a giver can hand out per UTC day, zero for no limit
+	DailyBudget int
+	// The most karma that can be given in one gift
+	MaxGiftAmount int
+	// If karma can be taken away
+	NegativeKarma bool
+	// If taking karma away can push a total below zero
+	NegativeTotals bool
+	// How long a giver has to take back a gift
+	UndoWindow time.Duration
+	// What gifts can be tagged with
+	Categories []string
+	// Where milestones and new leaders are announced, empty if they aren't. The milestones are
+	// the thresholds of the guild's role rewards.
+	AnnounceChannelID string
+}
+
+// ErrUnknownSetting is returned when changing a setting that doesn't exist
+var ErrUnknownSetting = errors.New("unknown setting")
+
+// A SettingError is returned when a setting is given a value it can't take
+type SettingError struct {
+	Key    string
+	Reason string
+}
+
+func (e SettingError) Error() string {
+	return fmt.Sprintf("invalid value for %s: %s", e.Key, e.Reason)
+}
+
+// A Setting is one of the GuildSettings a guild can change
+type Setting struct {
+	Key         string
+	Description string
+	// If the guild's commands need registering again after it changes
+	AffectsCommands bool
+
+	get func(GuildSettings) string
+	set func(*GuildSettings, string) error
+}
+
+// Value formats the setting's value the same way it's given
+func (s Setting) Value(gs GuildSettings) string {
+	return s.get(gs)
+}
+
+// The most categories a guild can have, since Discord allows 25 choices on an option
+const maxCategories = 25
+
+// Settings are all the settings a guild can change
+var Settings = []Setting{
+	{
+		Key:         "cooldown",
+		Description: "How long a giver has to wait before giving the same person karma again, like 1h",
+		get:         func(gs GuildSettings) string { return gs.PairCooldown.String() },
+		set: func(gs *GuildSettings, v string) (err error) {
+			gs.PairCooldown, err = parseDuration(v)
+			return err
+		},
+	},
+	{
+		Key:         "daily_budget",
+		Description: "How much karma each person can give per day, 0 for no limit",
+		get:         func(gs GuildSettings) string { return strconv.Itoa(gs.DailyBudget) },
+		set: func(gs *GuildSettings, v string) (err error) {
+			gs.DailyBudget, err = parseInt(v, 0)
+			return err
+		},
+	},
+	{
+		Key:             "max_amount",
+		Description:     "The most karma that can be given in one gib",
+		AffectsCommands: true,
+		get:             func(gs GuildSettings) string { return strconv.Itoa(gs.MaxGiftAmount) },
+		set: func(gs *GuildSettings, v string) (err error) {
+			gs.MaxGiftAmount, err = parseInt(v, 1)
+			return err
+		},
+	},
+	{
+		Key:             "negative_karma",
+		Description:     "If karma can be taken away with /yeet, true or false",
+		AffectsCommands: true,
+		get:             func(gs GuildSettings) string { return strconv.FormatBool(gs.NegativeKarma) },
+		set: func(gs *GuildSettings, v string) (err error) {
+			gs.NegativeKarma, err = parseBool(v)
+			return err
+		},
+	},
+	{
+		Key:         "negative_totals",
+		Description: "If taking karma away can push a total below zero, true or false",
+		get:         func(gs GuildSettings) string { return strconv.FormatBool(gs.NegativeTotals) },
+		set: func(gs *GuildSettings, v string) (err error) {
+			gs.NegativeTotals, err = parseBool(v)
+			return err
+		},
+	},
+	{
+		Key:         "undo_window",
+		Description: "How long a giver has to take back a gib, like 5m",
+		get:         func(gs GuildSettings) string { return gs.UndoWindow.String() },
+		set: func(gs *GuildSettings, v string) (err error) {
+			gs.UndoWindow, err = parseDuration(v)
+			return err
+		},
+	},
+	{
+		Key:             "categories",
+		Description:     "Comma-separated categories gibs can be tagged with, or none",
+		AffectsCommands: true,
+		get:             func(gs GuildSettings) string { return strings.Join(gs.Categories, ",") },
+		set: func(gs *GuildSettings, v string) error {
+			gs.Categories = nil
+			if strings.EqualFold(v, "none") {
+				return nil
+			}
+
+			for _, cat := range strings.Split(v, ",") {
+				cat = strings.TrimSpace(cat)
+				if cat == "" || contains(gs.Categories, cat) {
+					continue
+				}
+				if len([]rune(cat)) > 100 { // Discord's limit on choice names
+					return fmt.Errorf("%q is too long", cat)
+				}
+
+				gs.Categories = append(gs.Categories, cat)
+			}
+			if len(gs.Categories) > maxCategories {
+				return fmt.Errorf("there can be at most %d", maxCategories)
+			}
+
+			return nil
+		},
+	},
+	{
+		Key:         "announce_channel",
+		Description: "The channel new leaders and milestones are announced in, or none. The milestones are the totals set with /karmarewards",
+		get:         func(gs GuildSettings) string { return gs.AnnounceChannelID },
+		set: func(gs *GuildSettings, v string) error {
+			gs.AnnounceChannelID = ""
+			if v == "" || strings.EqualFold(v, "none") {
+				return nil
+			}
+
+			// Take a mention of the channel as well as its ID
+			id := strings.TrimSuffix(strings.TrimPrefix(v, "<#"), ">")
+			if _, err := strconv.ParseUint(id, 10, 64); err != nil {
+				return errors.New("not a channel")
+			}
+
+			gs.AnnounceChannelID = id
+			return nil
+		},
+	},
+}
+
+// SettingKeys returns the key of each setting in order
+func SettingKeys() []string {
+	keys := make([]string, 0, len(Settings))
+	for _, s := range Settings {
+		keys = append(keys, s.Key)
+	}
+
+	return keys
+}
+
+// LookupSetting returns the setting with the key
+func LookupSetting(key string) (Setting, bool) {
+	for _, s := range Settings {
+		if s.Key == key {
+			return s, true
+		}
+	}
+
+	return Setting{}, false
+}
+
+// GuildSettings returns the guild's settings, falling back to the defaults for anything
+// it hasn't changed
+func (c Core) GuildSettings(ctx context.Context, guildID string) (GuildSettings, error) {
+	stored, err := c.db.GetGuildSettings(ctx, guildID)
+	if err != nil {
+		return GuildSettings{}, fmt.Errorf("error getting settings: %s", err)
+	}
+
+	gs := c.defaultSettings(guildID)
+	for _, st := range stored {
+		s, ok := LookupSetting(st.Key)
+		if !ok { // Left behind by a setting that's been removed
+			continue
+		}
+
+		if err := s.set(&gs, st.Value); err != nil {
+			return GuildSettings{}, fmt.Errorf("error reading setting %s: %s", st.Key, err)
+		}
+	}
+
+	return gs, nil
+}
+
+// SetGuildSetting changes one of the guild's settings, returning all of them afterward
+func (c Core) SetGuildSetting(ctx context.Context, guildID, key, value string) (GuildSettings, error) {
+	s, ok := LookupSetting(key)
+	if !ok {
+		return GuildSettings{}, ErrUnknownSetting
+	}
+
+	gs, err := c.GuildSettings(ctx, guildID)
+	if err != nil {
+		return GuildSettings{}, err
+	}
+
+	if err := s.set(&gs, strings.TrimSpace(value)); err != nil {
+		return GuildSettings{}, SettingError{Key: key, Reason: err.Error()}
+	}
+
+	// Store it the way it's shown so it reads back the same
+	err = c.db.UpsertGuildSetting(ctx, models.GuildSetting{GuildID: guildID, Key: key, Value: s.get(gs)})
+	if err != nil {
+		return GuildSettings{}, fmt.Errorf("error storing setting: %s", err)
+	}
+
+	return gs, nil
+}
+
+// ResetGuildSetting puts one of the guild's settings back to the default, returning all of
+// them afterward
+func (c Core) ResetGuildSetting(ctx context.Context, guildID, key string) (GuildSettings, error) {
+	if _, ok := LookupSetting(key); !ok {
+		return GuildSettings{}, ErrUnknownSetting
+	}
+
+	if err := c.db.DeleteGuildSetting(ctx, guildID, key); err != nil {
+		return GuildSettings{}, fmt.Errorf("error removing setting: %s", err)
+	}
+
+	return c.GuildSettings(ctx, guildID)
+}
+
+// defaultSettings are the guild's settings before it's changed any, taken from the Config
+func (c Core) defaultSettings(guildID string) GuildSettings {
+	gs := GuildSettings{
+		PairCooldown:      c.cfg.PairCooldown,
+		DailyBudget:       c.cfg.DailyBudget,
+		MaxGiftAmount:     c.cfg.MaxGiftAmount,
+		NegativeKarma:     contains(c.cfg.NegativeKarmaGuildIDs, guildID),
+		NegativeTotals:    c.cfg.AllowNegativeTotals,
+		UndoWindow:        c.cfg.UndoWindow,
+		Categories:        c.cfg.Categories,
+		AnnounceChannelID: c.cfg.AnnounceChannelIDs[guildID],
+	}
+	if m, ok := c.cfg.GuildMaxGiftAmounts[guildID]; ok {
+		gs.MaxGiftAmount = m
+	}
+	if gs.MaxGiftAmount < 1 {
+		gs.MaxGiftAmount = 1
+	}
+	if cats, ok := c.cfg.GuildCategories[guildID]; ok {
+		gs.Categories = cats
+	}
+
+	return gs
+}
+
+func parseDuration(v string) (time.Duration, error) {
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		return 0, errors.New("not a duration like 30s, 5m or 1h")
+	}
+	if d < 0 {
+		return 0, errors.New("can't be negative")
+	}
+
+	return d, nil
+}
+
+func parseInt(v string, min int) (int, error) {
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		return 0, errors.New("not a whole number")
+	}
+	if n < min {
+		return 0, fmt.Errorf("must be at least %d", min)
+	}
+
+	return n, nil
+}
+
+func parseBool(v string) (bool, error) {
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		return false, errors.New("must be true or false")
+	}
+
+	return b, nil
+}
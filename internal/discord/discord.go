@@ -48,23 +48,109 @@ type command struct {
 	Type        uint            `json:"type"`
 	Description string          `json:"description"`
 	Options     []commandOption `json:"options"`
+
+	// A permission bit set the member needs to see the command, nil for everyone
+	DefaultMemberPermissions *string `json:"default_member_permissions,omitempty"`
+	// Where the command can be used, nil for discord's default
+	Contexts []int `json:"contexts,omitempty"`
 }
 
+// The GUILD interaction context, so a global command can't be used in DMs with the bot
+var guildContexts = []int{0}
+
+// Only members with the ADMINISTRATOR permission can see commands with this set
+var adminPermissions = "8"
+
 type commandOption struct {
 	Name        string `json:"name"`
 	Type        uint   `json:"type"`
 	Description string `json:"description"`
 	Required    bool   `json:"required"`
+	MinValue    *int   `json:"min_value,omitempty"`
+	MaxValue    *int   `json:"max_value,omitempty"`
+
+	Choices []optionChoice `json:"choices,omitempty"`
+
+	// The options of a SUB_COMMAND
+	Options []commandOption `json:"options,omitempty"`
+}
+
+type optionChoice struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// periodOption lets leaderboards be limited to a window of time
+var periodOption = commandOption{
+	Name:        "period",
+	Type:        3, // STRING
+	Description: "How far back to look, defaults to all time",
+	Choices: []optionChoice{
+		{Name: "This week", Value: "week"},
+		{Name: "This month", Value: "month"},
+		{Name: "This year", Value: "year"},
+		{Name: "All time", Value: "all"},
+	},
 }
 
-// RegisterCommands reaces out to discord to register all commands supported by the app
-func (c *Client) RegisterCommands(ctx context.Context, guildID string) error {
+// adminUserOption is the user a /karmaadmin subcommand acts on
+var adminUserOption = commandOption{
+	Name:        "user",
+	Type:        6, // USER
+	Description: "The user whose karma to change",
+	Required:    true,
+}
+
+// CommandConfig holds the per-guild choices that affect which commands are registered
+type CommandConfig struct {
+	// If the commands are registered globally and shared by every guild, so they can't be
+	// shaped by one guild's choices. Everything is registered and left to the server to check.
+	Global bool
+
+	// If the guild has opted in to taking karma away
+	AllowNegative bool
+	// The most karma that can be given in one gib
+	MaxGiftAmount int
+	// What gifts can be tagged with. Discord allows up to 25.
+	Categories []string
+	// The settings /karmaconfig can change
+	SettingKeys []string
+}
+
+// buildCommands builds every command supported by the app, shaped by the config
+func buildCommands(cc CommandConfig) []command {
+	minAmount := 1 // Also the lowest season number
+	var maxAmount *int
+	if cc.MaxGiftAmount > 0 && !cc.Global {
+		maxAmount = &cc.MaxGiftAmount
+	}
+
+	var categoryOpts []commandOption
+	if cc.Global {
+		// Each guild has its own categories, so they can't be offered as choices
+		categoryOpts = append(categoryOpts, commandOption{
+			Name:        "category",
+			Type:        3, // STRING
+			Description: "What kind of karma it is, if this server uses categories",
+		})
+	} else if len(cc.Categories) > 0 {
+		categoryOpt := commandOption{
+			Name:        "category",
+			Type:        3, // STRING
+			Description: "What kind of karma it is",
+		}
+		for _, cat := range cc.Categories {
+			categoryOpt.Choices = append(categoryOpt.Choices, optionChoice{Name: cat, Value: cat})
+		}
+		categoryOpts = append(categoryOpts, categoryOpt)
+	}
+
 	cmds := []command{
 		{
 			Name:        "gib",
 			Type:        1, // CHAT_INPUT
-			Description: "Give another user one karma",
-			Options: []commandOption{
+			Description: "Give another user karma",
+			Options: append([]commandOption{
 				{
 					Name:        "user",
 					Type:        6, // USER
@@ -77,7 +163,47 @@ func (c *Client) RegisterCommands(ctx context.Context, guildID string) error {
 					Description: "Message to accompany the gifting of karma",
 					Required:    true,
 				},
-			},
+				{
+					Name:        "amount",
+					Type:        4, // INTEGER
+					Description: "How much karma to give each user, defaults to one",
+					MinValue:    &minAmount,
+					MaxValue:    maxAmount,
+				},
+				{
+					Name:        "user2",
+					Type:        6, // USER
+					Description: "Another user to give karma to",
+				},
+				{
+					Name:        "user3",
+					Type:        6, // USER
+					Description: "Another user to give karma to",
+				},
+				{
+					Name:        "user4",
+					Type:        6, // USER
+					Description: "Another user to give karma to",
+				},
+				{
+					Name:        "user5",
+					Type:        6, // USER
+					Description: "Another user to give karma to",
+				},
+			}, categoryOpts...),
+		},
+		{
+			Name: "Give karma for this message",
+			Type: 3, // MESSAGE
+		},
+		{
+			Name: "Give karma",
+			Type: 2, // USER
+		},
+		{
+			Name:        "ungib",
+			Type:        1, // CHAT_INPUT
+			Description: "Take back the last karma you gave, if it was recent enough",
 		},
 		{
 			Name:        "checkkarma",
@@ -92,39 +218,307 @@ func (c *Client) RegisterCommands(ctx context.Context, guildID string) error {
 				},
 			},
 		},
+		{
+			Name:        "karmahistory",
+			Type:        1, // CHAT_INPUT
+			Description: "See who recently gave a user karma and why",
+			Options: []commandOption{
+				{
+					Name:        "user",
+					Type:        6, // USER
+					Description: "The user to check",
+					Required:    true,
+				},
+			},
+		},
 		{
 			Name:        "topten",
 			Type:        1, // CHAT_INPUT
 			Description: "Check the karma leaderboard",
+			Options:     append([]commandOption{periodOption}, categoryOpts...),
 		},
+		{
+			Name:        "topgivers",
+			Type:        1, // CHAT_INPUT
+			Description: "Check who has given away the most karma",
+			Options:     []commandOption{periodOption},
+		},
+		{
+			Name:        "myrank",
+			Type:        1, // CHAT_INPUT
+			Description: "Check where you are on the leaderboard",
+		},
+		{
+			Name:        "season",
+			Type:        1, // CHAT_INPUT
+			Description: "Check the top ten of a past season",
+			Options: []commandOption{
+				{
+					Name:        "number",
+					Type:        4, // INTEGER
+					Description: "Which season, defaults to the last one",
+					MinValue:    &minAmount,
+				},
+			},
+		},
+		{
+			Name:                     "endseason",
+			Type:                     1, // CHAT_INPUT
+			Description:              "Archive everyone's karma, announce the winners and start a new season",
+			DefaultMemberPermissions: &adminPermissions,
+		},
+		{
+			Name:                     "karmaadmin",
+			Type:                     1, // CHAT_INPUT
+			Description:              "Correct someone's karma by hand",
+			DefaultMemberPermissions: &adminPermissions,
+			Options: []commandOption{
+				{
+					Name:        "set",
+					Type:        1, // SUB_COMMAND
+					Description: "Overwrite a user's karma",
+					Options: []commandOption{
+						adminUserOption,
+						{
+							Name:        "count",
+							Type:        4, // INTEGER
+							Description: "Their new karma",
+							Required:    true,
+						},
+					},
+				},
+				{
+					Name:        "adjust",
+					Type:        1, // SUB_COMMAND
+					Description: "Add to or take away from a user's karma",
+					Options: []commandOption{
+						adminUserOption,
+						{
+							Name:        "amount",
+							Type:        4, // INTEGER
+							Description: "How much to add, negative to take away",
+							Required:    true,
+						},
+					},
+				},
+				{
+					Name:        "reset",
+					Type:        1, // SUB_COMMAND
+					Description: "Set a user's karma back to zero",
+					Options:     []commandOption{adminUserOption},
+				},
+				{
+					Name:        "transfer",
+					Type:        1, // SUB_COMMAND
+					Description: "Move an old account's karma and history to a new one",
+					Options: []commandOption{
+						{
+							Name:        "from",
+							Type:        6, // USER
+							Description: "The old account",
+							Required:    true,
+						},
+						{
+							Name:        "to",
+							Type:        6, // USER
+							Description: "The new account",
+							Required:    true,
+						},
+					},
+				},
+				{
+					Name:        "audit",
+					Type:        1, // SUB_COMMAND
+					Description: "Show the most recent changes made with this command",
+				},
+			},
+		},
+		{
+			Name:                     "karmarewards",
+			Type:                     1, // CHAT_INPUT
+			Description:              "Manage the roles given out at karma milestones",
+			DefaultMemberPermissions: &adminPermissions,
+			Options: []commandOption{
+				{
+					Name:        "add",
+					Type:        1, // SUB_COMMAND
+					Description: "Give a role to everyone who reaches a karma total",
+					Options: []commandOption{
+						{
+							Name:        "threshold",
+							Type:        4, // INTEGER
+							Description: "The karma total that earns the role",
+							Required:    true,
+							MinValue:    &minAmount,
+						},
+						{
+							Name:        "role",
+							Type:        8, // ROLE
+							Description: "The role to give",
+							Required:    true,
+						},
+					},
+				},
+				{
+					Name:        "remove",
+					Type:        1, // SUB_COMMAND
+					Description: "Stop giving out the role at a karma total",
+					Options: []commandOption{
+						{
+							Name:        "threshold",
+							Type:        4, // INTEGER
+							Description: "The karma total of the reward",
+							Required:    true,
+							MinValue:    &minAmount,
+						},
+					},
+				},
+				{
+					Name:        "list",
+					Type:        1, // SUB_COMMAND
+					Description: "Show the roles given out at each karma total",
+				},
+			},
+		},
+	}
+	if len(cc.SettingKeys) > 0 {
+		var settingChoices []optionChoice
+		for _, key := range cc.SettingKeys {
+			settingChoices = append(settingChoices, optionChoice{Name: key, Value: key})
+		}
+		settingOpt := commandOption{
+			Name:        "setting",
+			Type:        3, // STRING
+			Description: "Which setting",
+			Required:    true,
+			Choices:     settingChoices,
+		}
+
+		cmds = append(cmds, command{
+			Name:                     "karmaconfig",
+			Type:                     1, // CHAT_INPUT
+			Description:              "Change how karma works on this server",
+			DefaultMemberPermissions: &adminPermissions,
+			Options: []commandOption{
+				{
+					Name:        "view",
+					Type:        1, // SUB_COMMAND
+					Description: "Show every setting and what it's set to",
+				},
+				{
+					Name:        "set",
+					Type:        1, // SUB_COMMAND
+					Description: "Change a setting",
+					Options: []commandOption{
+						settingOpt,
+						{
+							Name:        "value",
+							Type:        3, // STRING
+							Description: "The new value",
+							Required:    true,
+						},
+					},
+				},
+				{
+					Name:        "reset",
+					Type:        1, // SUB_COMMAND
+					Description: "Put a setting back to the default",
+					Options:     []commandOption{settingOpt},
+				},
+			},
+		})
+	}
+	if cc.AllowNegative || cc.Global {
+		cmds = append(cmds, command{
+			Name:        "yeet",
+			Type:        1, // CHAT_INPUT
+			Description: "Take one karma away from another user",
+			Options: []commandOption{
+				{
+					Name:        "user",
+					Type:        6, // USER
+					Description: "The user to take karma from",
+					Required:    true,
+				},
+				{
+					Name:        "message",
+					Type:        3, // STRING
+					Description: "Why they deserve it",
+					Required:    true,
+				},
+			},
+		})
 	}
 
-	// The give karma command
-	for _, cmd := range cmds {
-		if err := c.registerCommand(ctx, cmd, guildID); err != nil {
-			return fmt.Errorf("error registering command %s: %s", cmd.Name, err)
+	// Guild commands can only be used in their guild, but global ones need telling
+	if cc.Global {
+		for j := range cmds {
+			cmds[j].Contexts = guildContexts
 		}
 	}
 
+	return cmds
+}
+
+// AddMemberRole gives the member a role in the guild. The bot needs the Manage Roles
+// permission and its own role has to be above the one it's giving. Error responses come
+// back as a *StatusError.
+func (c *Client) AddMemberRole(ctx context.Context, guildID, userID, roleID string) error {
+	u := fmt.Sprintf("https://discord.com/api/v10/guilds/%s/members/%s/roles/%s", guildID, userID, roleID)
+	req, err := http.NewRequest(http.MethodPut, u, nil)
+	if err != nil {
+		return fmt.Errorf("error creating request to add role: %s", err)
+	}
+	req = req.WithContext(ctx)
+	c.setupRequest(req)
+	req.Header.Add("X-Audit-Log-Reason", "Reached a karma milestone")
+
+	res, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("error doing request: %s", err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		se := readStatusErr(res)
+		c.l.Errorw("received error response from api", "err", se.Err, "status_code", res.StatusCode)
+		return se
+	}
+
+	c.l.Infow("sucessfully added member role", "guild_id", guildID, "user_id", userID, "role_id", roleID)
+
 	return nil
 }
 
-func (c *Client) registerCommand(ctx context.Context, cmd command, guildID string) error {
-	byts, err := json.Marshal(cmd)
+// The body of a request to post a message
+type messageCreate struct {
+	Content         string          `json:"content"`
+	AllowedMentions allowedMentions `json:"allowed_mentions"`
+}
+
+type allowedMentions struct {
+	Parse []string `json:"parse"`
+}
+
+// CreateMessage posts a message to the channel. Users mentioned in it are pinged, but roles
+// and everyone aren't.
+func (c *Client) CreateMessage(ctx context.Context, channelID, content string) error {
+	byts, err := json.Marshal(messageCreate{
+		Content:         content,
+		AllowedMentions: allowedMentions{Parse: []string{"users"}},
+	})
 	if err != nil {
-		return fmt.Errorf("error marshalling gib command: %s", err)
+		return fmt.Errorf("error marshalling message: %s", err)
 	}
 
-	u := fmt.Sprintf("https://discord.com/api/v10/applications/%s/guilds/%s/commands", c.appID, guildID)
+	u := fmt.Sprintf("https://discord.com/api/v10/channels/%s/messages", channelID)
 	req, err := http.NewRequest(http.MethodPost, u, bytes.NewReader(byts))
 	if err != nil {
-		return fmt.Errorf("error creating request to create gib command: %s", err)
+		return fmt.Errorf("error creating request to create message: %s", err)
 	}
 	req = req.WithContext(ctx)
 	c.setupRequest(req)
 
-	c.l.Debugw("calling to register commands", "url", u)
-
 	res, err := c.httpClient.Do(req)
 	if err != nil {
 		return fmt.Errorf("error doing request: %s", err)
@@ -141,7 +535,7 @@ func (c *Client) registerCommand(ctx context.Context, cmd command, guildID strin
 		return er
 	}
 
-	c.l.Infow("sucessfully called to register guild command", "command_name", cmd.Name)
+	c.l.Infow("sucessfully created message", "channel_id", channelID)
 
 	return nil
 }
@@ -4,6 +4,9 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"net/http"
+	"strconv"
+	"time"
 )
 
 type errResp map[string]any
@@ -20,3 +23,46 @@ func readErr(r io.Reader) (errResp, error) {
 
 	return er, nil
 }
+
+// StatusError is an error response from the api, along with its status code and how long
+// discord asked us to wait before trying again, if it did
+type StatusError struct {
+	StatusCode int
+	RetryAfter time.Duration
+	Err        error
+}
+
+func (se *StatusError) Error() string {
+	return fmt.Sprintf("status %d: %s", se.StatusCode, se.Err)
+}
+
+func (se *StatusError) Unwrap() error {
+	return se.Err
+}
+
+// Temporary reports whether the request could succeed if tried again: anything but a
+// client error, apart from being rate limited
+func (se *StatusError) Temporary() bool {
+	return se.StatusCode == http.StatusTooManyRequests || se.StatusCode < 400 || se.StatusCode >= 500
+}
+
+// readStatusErr reads the error out of a response that wasn't successful
+func readStatusErr(res *http.Response) *StatusError {
+	se := &StatusError{StatusCode: res.StatusCode}
+
+	er, err := readErr(res.Body)
+	if err != nil {
+		se.Err = fmt.Errorf("error reading error from body: %s", err)
+	} else {
+		se.Err = er
+	}
+
+	// Rate limits give the wait in seconds in the body, and in the header too
+	if secs, ok := er["retry_after"].(float64); ok {
+		se.RetryAfter = time.Duration(secs * float64(time.Second))
+	} else if secs, err := strconv.ParseFloat(res.Header.Get("Retry-After"), 64); err == nil {
+		se.RetryAfter = time.Duration(secs * float64(time.Second))
+	}
+
+	return se
+}
@@ -0,0 +1,81 @@
+package discord
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"go.uber.org/zap"
+)
+
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(r *http.Request) (*http.Response, error) {
+	return f(r)
+}
+
+func TestAddMemberRoleError(t *testing.T) {
+	tests := []struct {
+		name          string
+		status        int
+		header        http.Header
+		body          string
+		wantRetry     time.Duration
+		wantTemporary bool
+	}{
+		{
+			name:   "missing permissions",
+			status: http.StatusForbidden,
+			body:   `{"message": "Missing Permissions", "code": 50013}`,
+		},
+		{
+			name:          "rate limited",
+			status:        http.StatusTooManyRequests,
+			body:          `{"message": "You are being rate limited.", "retry_after": 1.5, "global": false}`,
+			wantRetry:     1500 * time.Millisecond,
+			wantTemporary: true,
+		},
+		{
+			name:          "rate limited with only the header",
+			status:        http.StatusTooManyRequests,
+			header:        http.Header{"Retry-After": []string{"3"}},
+			body:          `{"message": "You are being rate limited."}`,
+			wantRetry:     3 * time.Second,
+			wantTemporary: true,
+		},
+		{
+			name:          "server error without a body",
+			status:        http.StatusBadGateway,
+			wantTemporary: true,
+		},
+	}
+
+	for _, tt := range tests {
+		c := &Client{
+			httpClient: &http.Client{Transport: roundTripFunc(func(r *http.Request) (*http.Response, error) {
+				return &http.Response{
+					StatusCode: tt.status,
+					Header:     tt.header,
+					Body:       io.NopCloser(strings.NewReader(tt.body)),
+				}, nil
+			})},
+			l: zap.NewNop().Sugar(),
+		}
+
+		err := c.AddMemberRole(context.Background(), "1", "2", "3")
+		var se *StatusError
+		if !errors.As(err, &se) {
+			t.Fatalf("%s: AddMemberRole() = %v, want a *StatusError", tt.name, err)
+		}
+
+		want := []any{tt.status, tt.wantRetry, tt.wantTemporary}
+		if diff := cmp.Diff(want, []any{se.StatusCode, se.RetryAfter, se.Temporary()}); diff != "" {
+			t.Errorf("%s: AddMemberRole() error mismatch (-want +got):\n%s", tt.name, diff)
+		}
+	}
+}
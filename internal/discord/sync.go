@@ -0,0 +1,261 @@
+package discord
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// A CommandDiff is how the commands registered with discord differ from ours, by name
+type CommandDiff struct {
+	Added   []string
+	Removed []string
+	Changed []string
+}
+
+// Empty reports if the registered commands already match ours
+func (d CommandDiff) Empty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0 && len(d.Changed) == 0
+}
+
+func (d CommandDiff) String() string {
+	if d.Empty() {
+		return "no changes"
+	}
+
+	b := &strings.Builder{}
+	for _, name := range d.Added {
+		b.WriteString(fmt.Sprintf("+ %s\n", name))
+	}
+	for _, name := range d.Changed {
+		b.WriteString(fmt.Sprintf("~ %s\n", name))
+	}
+	for _, name := range d.Removed {
+		b.WriteString(fmt.Sprintf("- %s\n", name))
+	}
+
+	return strings.TrimSuffix(b.String(), "\n")
+}
+
+// SyncGuildCommands makes the guild's registered commands match the ones supported by the
+// app: it fetches what's registered, and if anything differs, overwrites them all in one
+// request. Commands we no longer have are removed. With dryRun nothing is changed, only
+// the diff is returned.
+func (c *Client) SyncGuildCommands(ctx context.Context, guildID string, cc CommandConfig, dryRun bool) (CommandDiff, error) {
+	u := fmt.Sprintf("https://discord.com/api/v10/applications/%s/guilds/%s/commands", c.appID, guildID)
+
+	diff, err := c.syncCommands(ctx, u, cc, dryRun)
+	if err != nil {
+		return CommandDiff{}, err
+	}
+
+	if !dryRun && !diff.Empty() {
+		c.l.Infow("sucessfully synced guild commands", "guild_id", guildID, "added", diff.Added, "changed", diff.Changed, "removed", diff.Removed)
+	}
+
+	return diff, nil
+}
+
+// SyncGlobalCommands does the same as SyncGuildCommands for the commands registered in
+// every guild. Discord can take a while to show changes to them.
+func (c *Client) SyncGlobalCommands(ctx context.Context, cc CommandConfig, dryRun bool) (CommandDiff, error) {
+	u := fmt.Sprintf("https://discord.com/api/v10/applications/%s/commands", c.appID)
+
+	cc.Global = true
+	diff, err := c.syncCommands(ctx, u, cc, dryRun)
+	if err != nil {
+		return CommandDiff{}, err
+	}
+
+	if !dryRun && !diff.Empty() {
+		c.l.Infow("sucessfully synced global commands", "added", diff.Added, "changed", diff.Changed, "removed", diff.Removed)
+	}
+
+	return diff, nil
+}
+
+// syncCommands diffs the commands registered at the url against ours and overwrites them if
+// they differ
+func (c *Client) syncCommands(ctx context.Context, u string, cc CommandConfig, dryRun bool) (CommandDiff, error) {
+	existing, err := c.getCommands(ctx, u)
+	if err != nil {
+		return CommandDiff{}, fmt.Errorf("error getting registered commands: %s", err)
+	}
+
+	cmds := buildCommands(cc)
+	diff, err := diffCommands(existing, cmds)
+	if err != nil {
+		return CommandDiff{}, fmt.Errorf("error comparing commands: %s", err)
+	}
+	if dryRun || diff.Empty() {
+		return diff, nil
+	}
+
+	if err := c.putCommands(ctx, u, cmds); err != nil {
+		return CommandDiff{}, fmt.Errorf("error overwriting commands: %s", err)
+	}
+
+	return diff, nil
+}
+
+// CommandsHash fingerprints the commands the config produces, so it changes whenever
+// they'd need syncing again
+func CommandsHash(cc CommandConfig) (string, error) {
+	byts, err := json.Marshal(buildCommands(cc))
+	if err != nil {
+		return "", fmt.Errorf("error marshalling commands: %s", err)
+	}
+
+	sum := sha256.Sum256(byts)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// getCommands fetches the commands registered at the url
+func (c *Client) getCommands(ctx context.Context, u string) ([]command, error) {
+	req, err := http.NewRequest(http.MethodGet, u, nil)
+	if err != nil {
+		return nil, fmt.Errorf("error creating request to get commands: %s", err)
+	}
+	req = req.WithContext(ctx)
+	c.setupRequest(req)
+
+	c.l.Debugw("calling to get commands", "url", u)
+
+	res, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error doing request: %s", err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		er, err := readErr(res.Body)
+		if err != nil {
+			return nil, fmt.Errorf("error reading error from body: %s", err)
+		}
+
+		c.l.Errorw("received error response from api", "err", er, "status_code", res.StatusCode)
+		return nil, er
+	}
+
+	var cmds []command
+	if err := json.NewDecoder(res.Body).Decode(&cmds); err != nil {
+		return nil, fmt.Errorf("error decoding commands: %s", err)
+	}
+
+	return cmds, nil
+}
+
+// putCommands replaces every command registered at the url with the given ones
+func (c *Client) putCommands(ctx context.Context, u string, cmds []command) error {
+	byts, err := json.Marshal(cmds)
+	if err != nil {
+		return fmt.Errorf("error marshalling commands: %s", err)
+	}
+
+	req, err := http.NewRequest(http.MethodPut, u, bytes.NewReader(byts))
+	if err != nil {
+		return fmt.Errorf("error creating request to overwrite commands: %s", err)
+	}
+	req = req.WithContext(ctx)
+	c.setupRequest(req)
+
+	c.l.Debugw("calling to overwrite commands", "url", u)
+
+	res, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("error doing request: %s", err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		er, err := readErr(res.Body)
+		if err != nil {
+			return fmt.Errorf("error reading error from body: %s", err)
+		}
+
+		c.l.Errorw("received error response from api", "err", er, "status_code", res.StatusCode)
+		return er
+	}
+
+	return nil
+}
+
+// diffCommands compares the registered commands to ours. Commands are matched by name and
+// type, since that's what discord treats as the same command.
+func diffCommands(existing, want []command) (CommandDiff, error) {
+	key := func(cmd command) string {
+		return fmt.Sprintf("%d:%s", cmd.Type, cmd.Name)
+	}
+
+	have := make(map[string]command, len(existing))
+	for _, cmd := range existing {
+		have[key(cmd)] = cmd
+	}
+
+	var diff CommandDiff
+	for _, cmd := range want {
+		old, ok := have[key(cmd)]
+		if !ok {
+			diff.Added = append(diff.Added, cmd.Name)
+			continue
+		}
+		delete(have, key(cmd))
+
+		same, err := sameCommand(old, cmd)
+		if err != nil {
+			return CommandDiff{}, err
+		}
+		if !same {
+			diff.Changed = append(diff.Changed, cmd.Name)
+		}
+	}
+	for _, cmd := range have {
+		diff.Removed = append(diff.Removed, cmd.Name)
+	}
+	sort.Strings(diff.Removed)
+
+	return diff, nil
+}
+
+// sameCommand compares the definitions of two commands. Discord leaves out empty fields we
+// send, so both are put in the same shape first.
+func sameCommand(a, b command) (bool, error) {
+	ab, err := json.Marshal(normalizeCommand(a))
+	if err != nil {
+		return false, fmt.Errorf("error marshalling command: %s", err)
+	}
+	bb, err := json.Marshal(normalizeCommand(b))
+	if err != nil {
+		return false, fmt.Errorf("error marshalling command: %s", err)
+	}
+
+	return bytes.Equal(ab, bb), nil
+}
+
+func normalizeCommand(cmd command) command {
+	cmd.Options = normalizeOptions(cmd.Options)
+	return cmd
+}
+
+func normalizeOptions(opts []commandOption) []commandOption {
+	if len(opts) == 0 {
+		return nil
+	}
+
+	normalized := make([]commandOption, 0, len(opts))
+	for _, opt := range opts {
+		opt.Options = normalizeOptions(opt.Options)
+		if len(opt.Choices) == 0 {
+			opt.Choices = nil
+		}
+		normalized = append(normalized, opt)
+	}
+
+	return normalized
+}
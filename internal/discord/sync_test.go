@@ -0,0 +1,226 @@
+package discord
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// What discord sends back for registered commands: its own fields added, and options,
+// required and empty choices left out
+const registeredCommands = `[
+	{
+		"id": "1",
+		"application_id": "2",
+		"version": "3",
+		"type": 1,
+		"name": "gib",
+		"description": "Gives karma",
+		"default_member_permissions": null,
+		"options": [
+			{"type": 6, "name": "user", "description": "Who to give karma to", "required": true},
+			{"type": 3, "name": "reason", "description": "Why", "choices": []}
+		]
+	},
+	{
+		"id": "4",
+		"application_id": "2",
+		"version": "5",
+		"type": 1,
+		"name": "endseason",
+		"description": "Ends the season",
+		"default_member_permissions": "8"
+	},
+	{
+		"id": "6",
+		"application_id": "2",
+		"version": "7",
+		"type": 2,
+		"name": "Gib karma",
+		"description": ""
+	}
+]`
+
+func ourCommands() []command {
+	return []command{
+		{
+			Name:        "gib",
+			Type:        1,
+			Description: "Gives karma",
+			Options: []commandOption{
+				{Name: "user", Type: 6, Description: "Who to give karma to", Required: true},
+				{Name: "reason", Type: 3, Description: "Why"},
+			},
+		},
+		{
+			Name:                     "endseason",
+			Type:                     1,
+			Description:              "Ends the season",
+			Options:                  []commandOption{},
+			DefaultMemberPermissions: &adminPermissions,
+		},
+		{
+			Name: "Gib karma",
+			Type: 2,
+		},
+	}
+}
+
+func TestDiffCommands(t *testing.T) {
+	var registered []command
+	if err := json.Unmarshal([]byte(registeredCommands), &registered); err != nil {
+		t.Fatalf("unexpected error decoding commands: %s", err)
+	}
+
+	tests := []struct {
+		name     string
+		existing []command
+		want     func([]command) []command
+		wantDiff CommandDiff
+	}{
+		{
+			name:     "discord's shape matches ours",
+			existing: registered,
+			want:     func(cmds []command) []command { return cmds },
+		},
+		{
+			name:     "nothing registered",
+			existing: nil,
+			want:     func(cmds []command) []command { return cmds },
+			wantDiff: CommandDiff{Added: []string{"gib", "endseason", "Gib karma"}},
+		},
+		{
+			name:     "command added",
+			existing: registered,
+			want: func(cmds []command) []command {
+				return append(cmds, command{Name: "topten", Type: 1, Description: "Checks the leaderboard"})
+			},
+			wantDiff: CommandDiff{Added: []string{"topten"}},
+		},
+		{
+			name:     "commands removed",
+			existing: registered,
+			want:     func(cmds []command) []command { return cmds[:1] },
+			wantDiff: CommandDiff{Removed: []string{"Gib karma", "endseason"}},
+		},
+		{
+			name:     "option changed",
+			existing: registered,
+			want: func(cmds []command) []command {
+				cmds[0].Options[1].Required = true
+				return cmds
+			},
+			wantDiff: CommandDiff{Changed: []string{"gib"}},
+		},
+		{
+			name:     "choices added",
+			existing: registered,
+			want: func(cmds []command) []command {
+				cmds[0].Options[1].Choices = []optionChoice{{Name: "Helpful", Value: "helpful"}}
+				return cmds
+			},
+			wantDiff: CommandDiff{Changed: []string{"gib"}},
+		},
+		{
+			name:     "permissions changed",
+			existing: registered,
+			want: func(cmds []command) []command {
+				cmds[1].DefaultMemberPermissions = nil
+				return cmds
+			},
+			wantDiff: CommandDiff{Changed: []string{"endseason"}},
+		},
+		{
+			name:     "same name with a different type",
+			existing: registered,
+			want: func(cmds []command) []command {
+				cmds[2].Type = 3
+				return cmds
+			},
+			wantDiff: CommandDiff{Added: []string{"Gib karma"}, Removed: []string{"Gib karma"}},
+		},
+	}
+
+	for _, tt := range tests {
+		got, err := diffCommands(tt.existing, tt.want(ourCommands()))
+		if err != nil {
+			t.Fatalf("%s: unexpected error diffing commands: %s", tt.name, err)
+		}
+
+		if diff := cmp.Diff(tt.wantDiff, got); diff != "" {
+			t.Errorf("%s: diffCommands() mismatch (-want +got):\n%s", tt.name, diff)
+		}
+	}
+}
+
+func TestDiffBuiltCommands(t *testing.T) {
+	configs := []CommandConfig{
+		{},
+		{AllowNegative: true, MaxGiftAmount: 5, Categories: []string{"helpful", "funny"}, SettingKeys: []string{"cooldown"}},
+		{Global: true, SettingKeys: []string{"cooldown"}},
+	}
+
+	for _, cc := range configs {
+		// Discord drops what we send empty, so registering and reading back shouldn't be a change
+		byts, err := json.Marshal(buildCommands(cc))
+		if err != nil {
+			t.Fatalf("%+v: unexpected error encoding commands: %s", cc, err)
+		}
+		var registered []command
+		if err := json.Unmarshal(byts, &registered); err != nil {
+			t.Fatalf("%+v: unexpected error decoding commands: %s", cc, err)
+		}
+
+		got, err := diffCommands(registered, buildCommands(cc))
+		if err != nil {
+			t.Fatalf("%+v: unexpected error diffing commands: %s", cc, err)
+		}
+		if !got.Empty() {
+			t.Errorf("%+v: diffCommands() after registering = %s, want no changes", cc, got)
+		}
+	}
+}
+
+func TestNormalizeOptions(t *testing.T) {
+	tests := []struct {
+		name string
+		opts []commandOption
+		want []commandOption
+	}{
+		{
+			name: "nil",
+		},
+		{
+			name: "empty",
+			opts: []commandOption{},
+		},
+		{
+			name: "empty choices",
+			opts: []commandOption{{Name: "reason", Type: 3, Choices: []optionChoice{}}},
+			want: []commandOption{{Name: "reason", Type: 3}},
+		},
+		{
+			name: "nested subcommand options",
+			opts: []commandOption{
+				{Name: "set", Type: 1, Options: []commandOption{
+					{Name: "setting", Type: 3, Choices: []optionChoice{}, Options: []commandOption{}},
+				}},
+				{Name: "view", Type: 1, Options: []commandOption{}},
+			},
+			want: []commandOption{
+				{Name: "set", Type: 1, Options: []commandOption{
+					{Name: "setting", Type: 3},
+				}},
+				{Name: "view", Type: 1},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		got := normalizeOptions(tt.opts)
+		if diff := cmp.Diff(tt.want, got); diff != "" {
+			t.Errorf("%s: normalizeOptions() mismatch (-want +got):\n%s", tt.name, diff)
+		}
+	}
+}
@@ -0,0 +1,49 @@
+package discserv
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jdholdren/karma/internal/core/models"
+)
+
+// announce posts about any milestone the receiver reached or first place they took to the
+// guild's announcement channel. Like rewards it happens in the background.
+func (s *Server) announce(ctx context.Context, change models.KarmaChange) {
+	if s.dc == nil || (len(change.Rewards) == 0 && !change.TookFirstPlace) {
+		return
+	}
+
+	gs, err := s.cr.GuildSettings(ctx, change.Event.GuildID)
+	if err != nil {
+		s.l.Errorw("error getting settings to announce", "err", err)
+		return
+	}
+	channelID := gs.AnnounceChannelID
+	if channelID == "" {
+		return
+	}
+
+	var msgs []string
+	if n := len(change.Rewards); n > 0 { // Only the highest if several were passed at once
+		msgs = append(msgs, fmt.Sprintf("🎉 <@%s> just reached %d karma!", change.Count.UserID, change.Rewards[n-1].Threshold))
+	}
+	if change.TookFirstPlace {
+		msgs = append(msgs, fmt.Sprintf("👑 <@%s> has taken first place with %d karma!", change.Count.UserID, change.Count.Count))
+	}
+	if len(msgs) == 0 {
+		return
+	}
+
+	go func() {
+		for _, msg := range msgs {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			err := s.dc.CreateMessage(ctx, channelID, msg)
+			cancel()
+			if err != nil {
+				s.l.Errorw("error announcing", "err", err, "guild_id", change.Event.GuildID, "channel_id", channelID)
+			}
+		}
+	}()
+}
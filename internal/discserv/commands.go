@@ -0,0 +1,106 @@
+package discserv
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jdholdren/karma/internal/core"
+	"github.com/jdholdren/karma/internal/discord"
+)
+
+// The hash of the global commands is stored in place of a guild's
+const globalHashKey = "global"
+
+// SyncCommands makes the guild's commands registered with discord match its settings,
+// returning what changed. An empty guildID syncs the global commands instead. With dryRun
+// nothing is changed.
+func (s *Server) SyncCommands(ctx context.Context, guildID string, dryRun bool) (discord.CommandDiff, error) {
+	cc, err := s.commandConfig(ctx, guildID)
+	if err != nil {
+		return discord.CommandDiff{}, err
+	}
+
+	var diff discord.CommandDiff
+	if guildID == "" {
+		diff, err = s.dc.SyncGlobalCommands(ctx, cc, dryRun)
+	} else {
+		diff, err = s.dc.SyncGuildCommands(ctx, guildID, cc, dryRun)
+	}
+	if err != nil {
+		return discord.CommandDiff{}, fmt.Errorf("error syncing commands: %s", err)
+	}
+	if dryRun {
+		return diff, nil
+	}
+
+	// Remember what was synced so it can be skipped next time if nothing changed
+	hash, err := discord.CommandsHash(cc)
+	if err != nil {
+		return discord.CommandDiff{}, err
+	}
+	if err := s.cr.SetCommandHash(ctx, hashKey(guildID), hash); err != nil {
+		return discord.CommandDiff{}, err
+	}
+
+	return diff, nil
+}
+
+// CommandsChanged reports if the guild's commands, or the global ones for an empty guildID,
+// differ from the ones last synced
+func (s *Server) CommandsChanged(ctx context.Context, guildID string) (bool, error) {
+	cc, err := s.commandConfig(ctx, guildID)
+	if err != nil {
+		return false, err
+	}
+
+	hash, err := discord.CommandsHash(cc)
+	if err != nil {
+		return false, err
+	}
+	synced, err := s.cr.GetCommandHash(ctx, hashKey(guildID))
+	if err != nil {
+		return false, err
+	}
+
+	return hash != synced, nil
+}
+
+// commandConfig shapes the guild's commands from its settings. The global commands aren't
+// shaped by any guild.
+func (s *Server) commandConfig(ctx context.Context, guildID string) (discord.CommandConfig, error) {
+	if guildID == "" {
+		return discord.CommandConfig{Global: true, SettingKeys: core.SettingKeys()}, nil
+	}
+
+	gs, err := s.cr.GuildSettings(ctx, guildID)
+	if err != nil {
+		return discord.CommandConfig{}, fmt.Errorf("error getting settings: %s", err)
+	}
+
+	return discord.CommandConfig{
+		AllowNegative: gs.NegativeKarma,
+		MaxGiftAmount: gs.MaxGiftAmount,
+		Categories:    gs.Categories,
+		SettingKeys:   core.SettingKeys(),
+	}, nil
+}
+
+func hashKey(guildID string) string {
+	if guildID == "" {
+		return globalHashKey
+	}
+
+	return guildID
+}
+
+// syncInBackground syncs the guild's commands outside of an interaction, so the response
+// isn't held up by discord
+func (s *Server) syncInBackground(guildID string) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	if _, err := s.SyncCommands(ctx, guildID, false); err != nil {
+		s.l.Errorw("error syncing commands in the background", "err", err, "guild_id", guildID)
+	}
+}
@@ -0,0 +1,100 @@
+package discserv
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// What discord sends to the webhook events endpoint
+type webhookEvent struct {
+	Type  uint              `json:"type"` // 0 for a ping, 1 for an event
+	Event *webhookEventBody `json:"event"`
+}
+
+type webhookEventBody struct {
+	Type string           `json:"type"`
+	Data applicationEvent `json:"data"`
+}
+
+// The data of an APPLICATION_AUTHORIZED event
+type applicationEvent struct {
+	IntegrationType uint            `json:"integration_type"` // 0 when added to a guild, 1 for a user
+	User            interactionUser `json:"user"`
+	Guild           *eventGuild     `json:"guild"`
+}
+
+type eventGuild struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+func (s *Server) handleDiscordEvent() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		l := s.l.With("method", "handleDiscordEvent")
+
+		if !discordgo.VerifyInteraction(r, s.key) {
+			l.Debug("verification failed")
+			http.Error(w, "invalid signature", http.StatusUnauthorized)
+			return
+		}
+
+		var ev webhookEvent
+		if err := json.NewDecoder(r.Body).Decode(&ev); err != nil {
+			l.Errorw("error decoding", "err", err)
+			http.Error(w, fmt.Sprintf("error decoding: %s", err), http.StatusBadRequest)
+			return
+		}
+
+		if ev.Type == 1 && ev.Event != nil {
+			l.Infow("event decoded", "type", ev.Event.Type)
+
+			if ev.Event.Type == "APPLICATION_AUTHORIZED" && ev.Event.Data.Guild != nil {
+				if err := s.handleGuildAdded(r.Context(), ev.Event.Data); err != nil {
+					l.Errorw("error adding guild", "err", err)
+					http.Error(w, fmt.Sprintf("error adding guild: %s", err), http.StatusInternalServerError)
+					return
+				}
+			}
+		}
+
+		// Discord only needs to hear back that the event arrived
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// handleGuildAdded records a guild the app was added to and registers its commands. It's
+// also sent when the app is added again, which can mean the commands were removed.
+func (s *Server) handleGuildAdded(ctx context.Context, data applicationEvent) error {
+	guild := data.Guild
+
+	added, err := s.cr.AddGuild(ctx, guild.ID)
+	if err != nil {
+		return err
+	}
+
+	s.l.Infow("app added to guild", "guild_id", guild.ID, "guild_name", guild.Name, "added_by", data.User.ID, "new", added)
+
+	// Global commands already show up in every guild
+	if !s.global {
+		go s.syncInBackground(guild.ID)
+	}
+
+	return nil
+}
+
+// isKnownGuild reports if the guild is served, either from the config or because the app
+// was added to it. With global commands every guild is.
+func (s *Server) isKnownGuild(ctx context.Context, guildID string) (bool, error) {
+	if guildID == "" {
+		return false, nil
+	}
+	if s.global || contains(s.guildIDs, guildID) {
+		return true, nil
+	}
+
+	return s.cr.IsKnownGuild(ctx, guildID)
+}
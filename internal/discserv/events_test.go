@@ -0,0 +1,83 @@
+package discserv
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestDecodeWebhookEvent(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want webhookEvent
+	}{
+		{
+			name: "ping",
+			body: `{"version": 1, "application_id": "1", "type": 0}`,
+			want: webhookEvent{Type: 0},
+		},
+		{
+			name: "added to a guild",
+			body: `{
+				"version": 1,
+				"application_id": "1",
+				"type": 1,
+				"event": {
+					"type": "APPLICATION_AUTHORIZED",
+					"timestamp": "2024-10-18T14:42:53.064834",
+					"data": {
+						"integration_type": 0,
+						"scopes": ["applications.commands", "bot"],
+						"user": {"id": "2", "username": "someone", "global_name": "Someone"},
+						"guild": {"id": "3", "name": "A guild", "owner_id": "2"}
+					}
+				}
+			}`,
+			want: webhookEvent{Type: 1, Event: &webhookEventBody{
+				Type: "APPLICATION_AUTHORIZED",
+				Data: applicationEvent{
+					IntegrationType: 0,
+					User:            interactionUser{ID: "2", Username: "someone"},
+					Guild:           &eventGuild{ID: "3", Name: "A guild"},
+				},
+			}},
+		},
+		{
+			name: "added to a user",
+			body: `{
+				"version": 1,
+				"application_id": "1",
+				"type": 1,
+				"event": {
+					"type": "APPLICATION_AUTHORIZED",
+					"timestamp": "2024-10-18T14:42:53.064834",
+					"data": {
+						"integration_type": 1,
+						"scopes": ["applications.commands"],
+						"user": {"id": "2", "username": "someone"}
+					}
+				}
+			}`,
+			want: webhookEvent{Type: 1, Event: &webhookEventBody{
+				Type: "APPLICATION_AUTHORIZED",
+				Data: applicationEvent{
+					IntegrationType: 1,
+					User:            interactionUser{ID: "2", Username: "someone"},
+				},
+			}},
+		},
+	}
+
+	for _, tt := range tests {
+		var got webhookEvent
+		if err := json.Unmarshal([]byte(tt.body), &got); err != nil {
+			t.Fatalf("%s: unexpected error decoding event: %s", tt.name, err)
+		}
+
+		if diff := cmp.Diff(tt.want, got); diff != "" {
+			t.Errorf("%s: decoded event mismatch (-want +got):\n%s", tt.name, diff)
+		}
+	}
+}
@@ -5,8 +5,11 @@ package discserv
 import (
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"hash/fnv"
 	"net/http"
+	"strconv"
 	"strings"
 	"time"
 
@@ -16,12 +19,18 @@ import (
 	"github.com/bwmarrin/discordgo"
 	"github.com/gorilla/mux"
 	"github.com/jdholdren/karma/internal/core"
+	"github.com/jdholdren/karma/internal/core/models"
+	"github.com/jdholdren/karma/internal/discord"
 	"go.uber.org/zap"
 )
 
 type Config struct {
 	Port      int
 	VerifyKey string
+	// Guilds served no matter if they're recorded in the database
+	GuildIDs []string
+	// If the commands are registered globally, so every guild is served
+	GlobalCommands bool
 
 	TLSCertFile string
 	TLSKeyFile  string
@@ -32,10 +41,14 @@ type Server struct {
 	*http.Server
 
 	cr  core.Core
+	dc  *discord.Client   // For calls to discord outside of responding to an interaction
 	key ed25519.PublicKey // The discord public key to verify requests from them
+
+	guildIDs []string
+	global   bool
 }
 
-func New(l *zap.SugaredLogger, c Config, cr core.Core) (*Server, error) {
+func New(l *zap.SugaredLogger, c Config, cr core.Core, dc *discord.Client) (*Server, error) {
 	r := mux.NewRouter()
 
 	keyBytes, err := hex.DecodeString(c.VerifyKey)
@@ -52,7 +65,11 @@ func New(l *zap.SugaredLogger, c Config, cr core.Core) (*Server, error) {
 			WriteTimeout: 5 * time.Second,
 		},
 		cr:  cr,
+		dc:  dc,
 		key: ed25519.PublicKey(keyBytes),
+
+		guildIDs: c.GuildIDs,
+		global:   c.GlobalCommands,
 	}
 
 	if c.TLSCertFile != "" && c.TLSKeyFile != "" { // TLS key/cert provided
@@ -71,6 +88,7 @@ func New(l *zap.SugaredLogger, c Config, cr core.Core) (*Server, error) {
 	}
 
 	r.HandleFunc("/interactions", s.handleDiscordInteraction()).Methods(http.MethodPost)
+	r.HandleFunc("/events", s.handleDiscordEvent()).Methods(http.MethodPost)
 	r.HandleFunc("/healthz", handleHealthCheck()).Methods(http.MethodGet)
 
 	r.Use(loggingMiddleware(l))
@@ -97,31 +115,132 @@ func loggingMiddleware(l *zap.SugaredLogger) mux.MiddlewareFunc {
 
 // What Discord sends us
 type interaction struct {
-	Type    uint            `json:"type"`
-	Data    interactionData `json:"data"`
-	GuildID string          `json:"guild_id"`
-	Token   string          `json:"token"`
+	ID        string          `json:"id"`
+	Type      uint            `json:"type"`
+	Data      interactionData `json:"data"`
+	GuildID   string          `json:"guild_id"`
+	ChannelID string          `json:"channel_id"`
+	Token     string          `json:"token"`
+
+	// Member is set when the interaction happens in a guild, User when it's in a DM
+	Member *interactionMember `json:"member"`
+	User   *interactionUser   `json:"user"`
+}
+
+type interactionMember struct {
+	User interactionUser `json:"user"`
+}
+
+// invoker is the user who triggered the interaction
+func (i interaction) invoker() interactionUser {
+	if i.Member != nil {
+		return i.Member.User
+	}
+	if i.User != nil {
+		return *i.User
+	}
+
+	return interactionUser{}
 }
 
 type interactionData struct {
 	Name     string              `json:"name"`
 	Options  []interactionOption `json:"options"`
 	Resolved resolvedData        `json:"resolved"`
+
+	// Set for USER and MESSAGE context menu commands
+	TargetID string `json:"target_id"`
+
+	// Set for MESSAGE_COMPONENT and MODAL_SUBMIT interactions
+	CustomID      string `json:"custom_id"`
+	ComponentType uint   `json:"component_type"`
+
+	// The submitted fields of a MODAL_SUBMIT, nested in action rows
+	Components []submittedComponent `json:"components"`
+}
+
+type submittedComponent struct {
+	Type       uint                 `json:"type"`
+	CustomID   string               `json:"custom_id"`
+	Value      string               `json:"value"`
+	Components []submittedComponent `json:"components"`
+}
+
+// fieldValue returns the value submitted in the modal for the named field
+func (d interactionData) fieldValue(customID string) string {
+	for _, row := range d.Components {
+		for _, c := range row.Components {
+			if c.CustomID == customID {
+				return c.Value
+			}
+		}
+	}
+
+	return ""
 }
 
 type interactionOption struct {
 	Name  string `json:"name"`
 	Type  uint   `json:"type"`
-	Value string `json:"value"`
+	Value any    `json:"value"` // A string, number or bool depending on the type
+
+	// The options given to a SUB_COMMAND
+	Options []interactionOption `json:"options"`
+}
+
+// subcommand returns the name of the chosen subcommand and the data with its options in place
+// of the command's, so the option helpers work on them
+func (d interactionData) subcommand() (string, interactionData) {
+	for _, o := range d.Options {
+		if o.Type == 1 { // SUB_COMMAND
+			d.Options = o.Options
+			return o.Name, d
+		}
+	}
+
+	return "", d
+}
+
+// stringOption returns the value of the named string-like option, or empty if it wasn't given
+func (d interactionData) stringOption(name string) string {
+	for _, o := range d.Options {
+		if o.Name == name {
+			v, _ := o.Value.(string)
+			return v
+		}
+	}
+
+	return ""
+}
+
+// intOption returns the value of the named integer option and if it was given
+func (d interactionData) intOption(name string) (int, bool) {
+	for _, o := range d.Options {
+		if o.Name == name {
+			v, ok := o.Value.(float64)
+			return int(v), ok
+		}
+	}
+
+	return 0, false
 }
 
 type resolvedData struct {
-	Users map[string]interactionUser `json:"users"`
+	Users    map[string]interactionUser    `json:"users"`
+	Messages map[string]interactionMessage `json:"messages"`
+}
+
+type interactionMessage struct {
+	ID        string          `json:"id"`
+	ChannelID string          `json:"channel_id"`
+	Content   string          `json:"content"`
+	Author    interactionUser `json:"author"`
 }
 
 type interactionUser struct {
 	ID       string `json:"id"`
 	Username string `json:"username"`
+	Bot      bool   `json:"bot"`
 }
 
 func (s *Server) handleDiscordInteraction() http.HandlerFunc {
@@ -149,11 +268,59 @@ func (s *Server) handleDiscordInteraction() http.HandlerFunc {
 			return
 		}
 
+		// Karma is kept per guild, so there's nowhere to keep it for a DM
+		if i.GuildID == "" {
+			writeEphemeralResponse(w, "Karma only works in servers.")
+			return
+		}
+
+		known, err := s.isKnownGuild(r.Context(), i.GuildID)
+		if err != nil {
+			l.Errorw("error checking guild", "err", err)
+			http.Error(w, fmt.Sprintf("error checking guild: %s", err), http.StatusInternalServerError)
+			return
+		}
+		if !known {
+			l.Warnw("interaction from unknown guild", "guild_id", i.GuildID)
+			writeEphemeralResponse(w, "Karma isn't set up for this server. Try adding the app again.")
+			return
+		}
+
 		if i.Type == 2 && i.Data.Name == "gib" {
 			s.handleGib(w, r, i)
 			return
 		}
 
+		if i.Type == 2 && i.Data.Name == gibMessageCommand {
+			s.handleGibMessage(w, r, i)
+			return
+		}
+
+		if i.Type == 2 && i.Data.Name == gibUserCommand {
+			s.handleGibUser(w, i)
+			return
+		}
+
+		if i.Type == 5 && strings.HasPrefix(i.Data.CustomID, gibModalPrefix+":") {
+			s.handleGibModal(w, r, i)
+			return
+		}
+
+		if i.Type == 2 && i.Data.Name == "ungib" {
+			s.handleUngib(w, r, i)
+			return
+		}
+
+		if i.Type == 3 && strings.HasPrefix(i.Data.CustomID, undoButtonPrefix+":") {
+			s.handleUndoButton(w, r, i)
+			return
+		}
+
+		if i.Type == 2 && i.Data.Name == "yeet" {
+			s.handleYeet(w, r, i)
+			return
+		}
+
 		if i.Type == 2 && i.Data.Name == "checkkarma" {
 			s.handleCheckKarma(w, r, i)
 			return
@@ -163,72 +330,464 @@ func (s *Server) handleDiscordInteraction() http.HandlerFunc {
 			s.handleLeaderboard(w, r, i)
 			return
 		}
+
+		if i.Type == 3 && strings.HasPrefix(i.Data.CustomID, leaderboardButtonPrefix+":") {
+			s.handleLeaderboardButton(w, r, i)
+			return
+		}
+
+		if i.Type == 2 && i.Data.Name == "topgivers" {
+			s.handleTopGivers(w, r, i)
+			return
+		}
+
+		if i.Type == 2 && i.Data.Name == "myrank" {
+			s.handleMyRank(w, r, i)
+			return
+		}
+
+		if i.Type == 2 && i.Data.Name == "karmahistory" {
+			s.handleKarmaHistory(w, r, i)
+			return
+		}
+
+		if i.Type == 3 && strings.HasPrefix(i.Data.CustomID, historyButtonPrefix+":") {
+			s.handleKarmaHistoryButton(w, r, i)
+			return
+		}
+
+		if i.Type == 2 && i.Data.Name == "season" {
+			s.handleSeason(w, r, i)
+			return
+		}
+
+		if i.Type == 2 && i.Data.Name == "endseason" {
+			s.handleEndSeason(w, r, i)
+			return
+		}
+
+		if i.Type == 2 && i.Data.Name == "karmaconfig" {
+			s.handleKarmaConfig(w, r, i)
+			return
+		}
+
+		if i.Type == 2 && i.Data.Name == "karmarewards" {
+			s.handleKarmaRewards(w, r, i)
+			return
+		}
+
+		if i.Type == 2 && i.Data.Name == "karmaadmin" {
+			s.handleKarmaAdmin(w, r, i)
+			return
+		}
 	}
 }
 
 func (s *Server) handlePing(w http.ResponseWriter) {
-	w.Header().Add("Content-Type", "application/json")
-	_, _ = w.Write([]byte(`{ "type": 1 }`))
-}
-
-const (
-	// A body with mentions
-	mentionBody = `
-	{
-		"type": 4,
-		"data": {
-			"tts": false,
-			"content": "%s",
-			"embeds": []
-		}
-	}
-	`
-	mentionlessBody = `
-	{
-		"type": 4,
-		"data": {
-			"tts": false,
-			"content": "%s",
-			"embeds": [],
-			"allowed_mentions": {
-				"parse": []
-			}
+	writeResponse(w, interactionResponse{Type: responsePong})
+}
+
+// The user options /gib takes, beyond the first, for thanking several people at once
+var extraGibUserOptions = []string{"user2", "user3", "user4", "user5"}
+
+func (s *Server) handleGib(w http.ResponseWriter, r *http.Request, i interaction) {
+	amount, ok := i.Data.intOption("amount")
+	if !ok {
+		amount = 1
+	}
+
+	var givenIDs []string
+	for _, opt := range append([]string{"user"}, extraGibUserOptions...) {
+		id := i.Data.stringOption(opt)
+		if id == "" || contains(givenIDs, id) {
+			continue
 		}
+
+		if i.Data.Resolved.Users[id].Bot {
+			writeEphemeralResponse(w, "Bots don't need karma, but it's the thought that counts.")
+			return
+		}
+
+		givenIDs = append(givenIDs, id)
+	}
+
+	evs := make([]models.KarmaEvent, 0, len(givenIDs))
+	for _, id := range givenIDs {
+		evs = append(evs, models.KarmaEvent{
+			GuildID:       i.GuildID,
+			GiverID:       i.invoker().ID,
+			ReceiverID:    id,
+			Amount:        amount,
+			Reason:        i.Data.stringOption("message"),
+			Category:      i.Data.stringOption("category"),
+			ChannelID:     i.ChannelID,
+			InteractionID: i.ID,
+		})
+	}
+
+	if len(evs) == 1 {
+		change, ok := s.addKarma(w, r, evs[0])
+		if !ok {
+			return
+		}
+
+		writeGiftResponse(w, change)
+		return
 	}
-	`
-)
 
-func writeMsgResponse(w http.ResponseWriter, message string, allowMentions bool) {
-	w.Header().Add("Content-Type", "application/json")
-	body := mentionBody
-	if !allowMentions {
-		body = mentionlessBody
+	changes, err := s.cr.AddKarmaToMany(r.Context(), evs)
+	if msg := giftErrorMessage(err); msg != "" {
+		writeEphemeralResponse(w, msg)
+		return
+	}
+	if err != nil {
+		s.l.Errorw("error adding karma", "err", err)
+		http.Error(w, fmt.Sprintf("error adding karma: %s", err), http.StatusInternalServerError)
+		return
 	}
-	resp := fmt.Sprintf(body, message)
-	_, _ = w.Write([]byte(resp))
+
+	s.l.Infow("sucessfully added karma", "given_to", givenIDs, "given_by", i.invoker().ID)
+	for _, change := range changes {
+		s.grantRewards(change)
+		s.announce(r.Context(), change)
+	}
+
+	b := &strings.Builder{}
+	b.WriteString(fmt.Sprintf("You gave %d people karma for '%s'. Their totals are now:\n", len(changes), evs[0].Reason))
+	for _, change := range changes {
+		b.WriteString(fmt.Sprintf("<@%s>: %d\n", change.Count.UserID, change.Count.Count))
+	}
+
+	writeMentionResponse(w, b.String(), givenIDs...)
 }
 
-func (s *Server) handleGib(w http.ResponseWriter, r *http.Request, i interaction) {
-	guildID := i.GuildID
-	givenID := i.Data.Options[0].Value
-	msg := i.Data.Options[1].Value
+func contains(ss []string, s string) bool {
+	for _, v := range ss {
+		if v == s {
+			return true
+		}
+	}
+
+	return false
+}
+
+// The name of the message context menu command, which is what Discord shows in the menu
+const gibMessageCommand = "Give karma for this message"
+
+// Reasons taken from a message's content are cut short to this length
+const messageReasonLength = 200
+
+func (s *Server) handleGibMessage(w http.ResponseWriter, r *http.Request, i interaction) {
+	msg, ok := i.Data.Resolved.Messages[i.Data.TargetID]
+	if !ok {
+		http.Error(w, "target message not resolved", http.StatusBadRequest)
+		return
+	}
+
+	if msg.Author.Bot {
+		writeEphemeralResponse(w, "Bots don't need karma, but it's the thought that counts.")
+		return
+	}
+
+	// Fall back to a link when there's no text, like for an image
+	reason := msg.Content
+	if len([]rune(reason)) > messageReasonLength {
+		reason = string([]rune(reason)[:messageReasonLength]) + "…"
+	}
+	if reason == "" {
+		reason = fmt.Sprintf("https://discord.com/channels/%s/%s/%s", i.GuildID, msg.ChannelID, msg.ID)
+	}
+
+	change, ok := s.addKarma(w, r, models.KarmaEvent{
+		GuildID:       i.GuildID,
+		GiverID:       i.invoker().ID,
+		ReceiverID:    msg.Author.ID,
+		Amount:        1,
+		Reason:        reason,
+		ChannelID:     msg.ChannelID,
+		MessageID:     msg.ID,
+		InteractionID: i.ID,
+	})
+	if !ok {
+		return
+	}
+
+	writeGiftResponse(w, change)
+}
+
+// The name of the user context menu command, which is what Discord shows in the menu
+const gibUserCommand = "Give karma"
+
+// The custom ID of the modal asking for a reason is this prefix followed by the receiver's ID
+const gibModalPrefix = "gib"
+
+// How long a reason typed into the modal can be
+const modalReasonLength = 500
 
-	count, err := s.cr.AddKarma(r.Context(), guildID, givenID)
+// Context menu commands can't take options, so ask for the reason with a modal
+func (s *Server) handleGibUser(w http.ResponseWriter, i interaction) {
+	target := i.Data.Resolved.Users[i.Data.TargetID]
+	if target.Bot {
+		writeEphemeralResponse(w, "Bots don't need karma, but it's the thought that counts.")
+		return
+	}
+	if target.ID == i.invoker().ID {
+		writeEphemeralResponse(w, "Nice try, but you can't give karma to yourself.")
+		return
+	}
+
+	title := fmt.Sprintf("Give %s karma", target.Username)
+	if len([]rune(title)) > 45 { // Discord's limit on modal titles
+		title = "Give karma"
+	}
+
+	writeResponse(w, interactionResponse{
+		Type: responseModal,
+		Data: &responseData{
+			CustomID: gibModalID(target.ID),
+			Title:    title,
+			Components: []component{
+				actionRow(textInput("message", "What are you thanking them for?", modalReasonLength)),
+			},
+		},
+	})
+}
+
+func gibModalID(receiverID string) string {
+	return fmt.Sprintf("%s:%s", gibModalPrefix, receiverID)
+}
+
+// parseGibModal reads the receiver's ID back out of the modal's custom ID
+func parseGibModal(customID string) (string, bool) {
+	receiverID, ok := strings.CutPrefix(customID, gibModalPrefix+":")
+	if !ok || receiverID == "" || strings.Contains(receiverID, ":") {
+		return "", false
+	}
+
+	return receiverID, true
+}
+
+func (s *Server) handleGibModal(w http.ResponseWriter, r *http.Request, i interaction) {
+	receiverID, ok := parseGibModal(i.Data.CustomID)
+	if !ok {
+		http.Error(w, "malformed gib modal", http.StatusBadRequest)
+		return
+	}
+
+	change, ok := s.addKarma(w, r, models.KarmaEvent{
+		GuildID:       i.GuildID,
+		GiverID:       i.invoker().ID,
+		ReceiverID:    receiverID,
+		Amount:        1,
+		Reason:        i.Data.fieldValue("message"),
+		ChannelID:     i.ChannelID,
+		InteractionID: i.ID,
+	})
+	if !ok {
+		return
+	}
+
+	writeGiftResponse(w, change)
+}
+
+// addKarma gives the karma, writing an error response if it can't be given
+func (s *Server) addKarma(w http.ResponseWriter, r *http.Request, ev models.KarmaEvent) (models.KarmaChange, bool) {
+	change, err := s.cr.AddKarma(r.Context(), ev)
+	if msg := giftErrorMessage(err); msg != "" {
+		writeEphemeralResponse(w, msg)
+		return models.KarmaChange{}, false
+	}
 	if err != nil {
 		s.l.Errorw("error adding karma", "err", err)
 		http.Error(w, fmt.Sprintf("error adding karma: %s", err), http.StatusInternalServerError)
+		return models.KarmaChange{}, false
+	}
+
+	s.l.Infow("sucessfully added karma", "given_to", ev.ReceiverID, "given_by", ev.GiverID)
+	s.grantRewards(change)
+	s.announce(r.Context(), change)
+
+	return change, true
+}
+
+// giftErrorMessage explains to the giver why a gift wasn't allowed. It's empty for
+// errors that aren't the giver's fault.
+func giftErrorMessage(err error) string {
+	var (
+		rle core.RateLimitError
+		ae  core.AmountError
+	)
+	switch {
+	case errors.Is(err, core.ErrSelfKarma):
+		return "Nice try, but you can't give karma to yourself."
+	case errors.As(err, &rle):
+		return fmt.Sprintf("Slow down, you %s. You can give again <t:%d:R>.", rle.Reason, rle.RetryAt.Unix())
+	case errors.As(err, &ae):
+		return fmt.Sprintf("You can give between 1 and %d karma at a time.", ae.Max)
+	case errors.Is(err, core.ErrUnknownCategory):
+		return "That category isn't used on this server."
+	default:
+		return ""
+	}
+}
+
+// writeGiftResponse announces the gift with a button to undo it. The reason can be someone
+// else's message, so only the receiver is pinged.
+func writeGiftResponse(w http.ResponseWriter, change models.KarmaChange) {
+	ev := change.Event
+	content := fmt.Sprintf("You gave <@%s> karma for '%s'. Their total is now %d", ev.ReceiverID, ev.Reason, change.Count.Count)
+	if ev.Amount > 1 {
+		content = fmt.Sprintf("You gave <@%s> %d karma for '%s'. Their total is now %d", ev.ReceiverID, ev.Amount, ev.Reason, change.Count.Count)
+	}
+
+	writeResponse(w, interactionResponse{
+		Type: responseChannelMessage,
+		Data: &responseData{
+			Content:         content,
+			AllowedMentions: mentionOnly(ev.ReceiverID),
+			Components: []component{
+				actionRow(button(undoButtonID(ev.ID), "Undo")),
+			},
+		},
+	})
+}
+
+// The custom ID of the undo button on a gib is this prefix followed by the event ID
+const undoButtonPrefix = "undo"
+
+func undoButtonID(eventID int64) string {
+	return fmt.Sprintf("%s:%d", undoButtonPrefix, eventID)
+}
+
+// parseUndoButton reads the event ID back out of an undo button's custom ID
+func parseUndoButton(customID string) (int64, bool) {
+	id, ok := strings.CutPrefix(customID, undoButtonPrefix+":")
+	if !ok {
+		return 0, false
+	}
+	eventID, err := strconv.ParseInt(id, 10, 64)
+	if err != nil || eventID < 1 {
+		return 0, false
+	}
+
+	return eventID, true
+}
+
+func (s *Server) handleUngib(w http.ResponseWriter, r *http.Request, i interaction) {
+	change, ok := s.undoGift(w, r, i, 0)
+	if !ok {
 		return
 	}
 
-	s.l.Infow("sucessfully added karma", "given_to", givenID)
+	content := fmt.Sprintf("You took back the karma you gave <@%s>. Their total is now %d", change.Event.ReceiverID, change.Count.Count)
+	writeMsgResponse(w, content, false)
+}
 
-	content := fmt.Sprintf("You gave <@%s> karma for '%s'. Their total is now %d", givenID, msg, count.Count)
-	writeMsgResponse(w, content, true)
+func (s *Server) handleUndoButton(w http.ResponseWriter, r *http.Request, i interaction) {
+	eventID, ok := parseUndoButton(i.Data.CustomID)
+	if !ok {
+		s.l.Errorw("error parsing undo button", "custom_id", i.Data.CustomID)
+		http.Error(w, "malformed undo button", http.StatusBadRequest)
+		return
+	}
+
+	change, ok := s.undoGift(w, r, i, eventID)
+	if !ok {
+		return
+	}
+
+	// Replace the original gib message and disable the button
+	undone := button(i.Data.CustomID, "Undone")
+	undone.Disabled = true
+
+	content := fmt.Sprintf("<@%s> took back the karma they gave <@%s>. Their total is now %d", change.Event.GiverID, change.Event.ReceiverID, change.Count.Count)
+	writeResponse(w, interactionResponse{
+		Type: responseUpdateMessage,
+		Data: &responseData{
+			Content:         content,
+			AllowedMentions: &allowedMentions{Parse: []string{}},
+			Components:      []component{actionRow(undone)},
+		},
+	})
+}
+
+// undoGift undoes the gift for the invoker, writing an error response if it can't be done
+func (s *Server) undoGift(w http.ResponseWriter, r *http.Request, i interaction, eventID int64) (models.KarmaChange, bool) {
+	change, err := s.cr.UndoGift(r.Context(), i.GuildID, i.invoker().ID, eventID)
+	if errors.Is(err, core.ErrNothingToUndo) {
+		writeEphemeralResponse(w, "There's no gift to undo.")
+		return models.KarmaChange{}, false
+	}
+	if errors.Is(err, core.ErrNotGiver) {
+		writeEphemeralResponse(w, "Only the person who gave the karma can undo it.")
+		return models.KarmaChange{}, false
+	}
+	if errors.Is(err, core.ErrUndoWindowPassed) {
+		writeEphemeralResponse(w, "It's too late to undo that gift.")
+		return models.KarmaChange{}, false
+	}
+	if err != nil {
+		s.l.Errorw("error undoing gift", "err", err)
+		http.Error(w, fmt.Sprintf("error undoing gift: %s", err), http.StatusInternalServerError)
+		return models.KarmaChange{}, false
+	}
+
+	s.l.Infow("sucessfully undid gift", "event_id", change.Event.ID, "given_by", change.Event.GiverID)
+
+	return change, true
+}
+
+func (s *Server) handleYeet(w http.ResponseWriter, r *http.Request, i interaction) {
+	guildID := i.GuildID
+	takenID := i.Data.stringOption("user")
+	msg := i.Data.stringOption("message")
+
+	if i.Data.Resolved.Users[takenID].Bot {
+		writeEphemeralResponse(w, "Leave the bots alone, they're doing their best.")
+		return
+	}
+
+	change, err := s.cr.RemoveKarma(r.Context(), models.KarmaEvent{
+		GuildID:       guildID,
+		GiverID:       i.invoker().ID,
+		ReceiverID:    takenID,
+		Reason:        msg,
+		ChannelID:     i.ChannelID,
+		InteractionID: i.ID,
+	})
+	if errors.Is(err, core.ErrNegativeKarmaDisabled) {
+		writeEphemeralResponse(w, "Taking karma away isn't enabled on this server.")
+		return
+	}
+	if errors.Is(err, core.ErrSelfKarma) {
+		writeEphemeralResponse(w, "You can't take karma from yourself. Be kinder to yourself.")
+		return
+	}
+	var rle core.RateLimitError
+	if errors.As(err, &rle) {
+		writeEphemeralResponse(w, fmt.Sprintf("Slow down, you %s. You can try again <t:%d:R>.", rle.Reason, rle.RetryAt.Unix()))
+		return
+	}
+	if err != nil {
+		s.l.Errorw("error removing karma", "err", err)
+		http.Error(w, fmt.Sprintf("error removing karma: %s", err), http.StatusInternalServerError)
+		return
+	}
+
+	if change.Event.ID == 0 {
+		writeEphemeralResponse(w, fmt.Sprintf("<@%s> doesn't have any karma left to take.", takenID))
+		return
+	}
+
+	s.l.Infow("sucessfully removed karma", "taken_from", takenID, "taken_by", i.invoker().ID)
+
+	content := fmt.Sprintf("You took karma from <@%s> for '%s'. Their total is now %d", takenID, msg, change.Count.Count)
+	writeMentionResponse(w, content, takenID)
 }
 
 func (s *Server) handleCheckKarma(w http.ResponseWriter, r *http.Request, i interaction) {
-	userID := i.Data.Options[0].Value
-	username := i.Data.Resolved.Users[i.Data.Options[0].Value].Username
+	userID := i.Data.stringOption("user")
+	username := i.Data.Resolved.Users[userID].Username
 
 	count, err := s.cr.GetKarma(r.Context(), i.GuildID, userID)
 	if err != nil {
@@ -237,28 +796,435 @@ func (s *Server) handleCheckKarma(w http.ResponseWriter, r *http.Request, i inte
 		return
 	}
 
+	breakdown, err := s.cr.GetCategoryCounts(r.Context(), i.GuildID, userID)
+	if err != nil {
+		s.l.Errorw("error checking karma categories", "err", err)
+		http.Error(w, fmt.Sprintf("error checking karma categories: %s", err), http.StatusInternalServerError)
+		return
+	}
+
 	s.l.Infow("sucessfully checked karma", "username", username)
 
 	content := fmt.Sprintf("Checked %s's karma. Their total is %d", username, count.Count)
+
+	// Only worth breaking down if something was given with a category
+	var cats []string
+	for _, cc := range breakdown {
+		if cc.Category != "" {
+			cats = append(cats, fmt.Sprintf("%s: %d", cc.Category, cc.Count))
+		}
+	}
+	if len(cats) > 0 {
+		content += fmt.Sprintf(" (%s)", strings.Join(cats, ", "))
+	}
+
 	writeMsgResponse(w, content, false)
 }
 
+// How each period is described in a leaderboard's heading
+var periodHeadings = map[core.Period]string{
+	core.PeriodWeek:    "this week",
+	core.PeriodMonth:   "this month",
+	core.PeriodYear:    "this year",
+	core.PeriodAllTime: "of all time",
+}
+
+// How many users are shown on each page of the leaderboard
+const leaderboardPageSize = 10
+
+// The custom IDs of the leaderboard's buttons are this prefix followed by the period, page
+// and category key
+const leaderboardButtonPrefix = "leaderboard"
+
 func (s *Server) handleLeaderboard(w http.ResponseWriter, r *http.Request, i interaction) {
-	counts, err := s.cr.GetTopCounts(r.Context(), i.GuildID, 10)
+	period := core.Period(i.Data.stringOption("period"))
+	if _, ok := periodHeadings[period]; !ok {
+		period = core.PeriodAllTime
+	}
+
+	data, err := s.leaderboardPage(r, i.GuildID, period, i.Data.stringOption("category"), 0)
 	if err != nil {
 		s.l.Errorw("error checking leaderboard", "err", err)
 		http.Error(w, fmt.Sprintf("error checking leaderboard: %s", err), http.StatusInternalServerError)
 		return
 	}
 
+	writeResponse(w, interactionResponse{Type: responseChannelMessage, Data: data})
+}
+
+func (s *Server) handleLeaderboardButton(w http.ResponseWriter, r *http.Request, i interaction) {
+	period, page, key, ok := parseLeaderboardButton(i.Data.CustomID)
+	if !ok {
+		http.Error(w, "malformed leaderboard button", http.StatusBadRequest)
+		return
+	}
+
+	var category string
+	if key != "" {
+		gs, err := s.cr.GuildSettings(r.Context(), i.GuildID)
+		if err != nil {
+			s.l.Errorw("error getting guild settings", "err", err)
+			http.Error(w, fmt.Sprintf("error getting guild settings: %s", err), http.StatusInternalServerError)
+			return
+		}
+
+		for _, cat := range gs.Categories {
+			if categoryKey(cat) == key {
+				category = cat
+			}
+		}
+		if category == "" {
+			writeEphemeralResponse(w, "That category isn't used on this server anymore.")
+			return
+		}
+	}
+
+	data, err := s.leaderboardPage(r, i.GuildID, period, category, page)
+	if err != nil {
+		s.l.Errorw("error checking leaderboard", "err", err)
+		http.Error(w, fmt.Sprintf("error checking leaderboard: %s", err), http.StatusInternalServerError)
+		return
+	}
+
+	writeResponse(w, interactionResponse{Type: responseUpdateMessage, Data: data})
+}
+
+// leaderboardPage builds the message for one page of the leaderboard, with buttons
+// to move between pages
+func (s *Server) leaderboardPage(r *http.Request, guildID string, period core.Period, category string, page int) (*responseData, error) {
+	// Ask for one extra to know if there's a next page
+	offset := page * leaderboardPageSize
+	counts, err := s.cr.GetTopCountsForPeriod(r.Context(), guildID, period, category, leaderboardPageSize+1, offset)
+	if err != nil {
+		return nil, err
+	}
+	hasNext := len(counts) > leaderboardPageSize
+	if hasNext {
+		counts = counts[:leaderboardPageSize]
+	}
+
+	b := &strings.Builder{}
+	if category != "" {
+		b.WriteString(fmt.Sprintf("Top %s karma %s:\n", category, periodHeadings[period]))
+	} else {
+		b.WriteString(fmt.Sprintf("Top karma %s:\n", periodHeadings[period]))
+	}
+	for _, count := range counts {
+		b.WriteString(fmt.Sprintf("%d. <@%s>: %d karma \n", count.Rank, count.UserID, count.Count))
+	}
+
+	prev := button(leaderboardButtonID(period, page-1, category), "Previous")
+	prev.Disabled = page == 0
+	next := button(leaderboardButtonID(period, page+1, category), "Next")
+	next.Disabled = !hasNext
+
+	return &responseData{
+		Content:         b.String(),
+		AllowedMentions: &allowedMentions{Parse: []string{}},
+		Components:      []component{actionRow(prev, next)},
+	}, nil
+}
+
+// leaderboardButtonID builds the custom ID of a button that shows the page of the leaderboard
+func leaderboardButtonID(period core.Period, page int, category string) string {
+	return fmt.Sprintf("%s:%s:%d:%s", leaderboardButtonPrefix, period, page, categoryKey(category))
+}
+
+// parseLeaderboardButton reads the period, page and category key back out of a leaderboard
+// button's custom ID, which looks like leaderboard:<period>:<page>:<category key>
+func parseLeaderboardButton(customID string) (core.Period, int, string, bool) {
+	parts := strings.SplitN(customID, ":", 4)
+	if len(parts) != 4 || parts[0] != leaderboardButtonPrefix {
+		return "", 0, "", false
+	}
+	page, err := strconv.Atoi(parts[2])
+	if err != nil || page < 0 {
+		return "", 0, "", false
+	}
+
+	return core.Period(parts[1]), page, parts[3], true
+}
+
+// categoryKey shortens a category to fit in a button's custom ID, which Discord limits to
+// 100 characters. The button maps it back through the guild's categories.
+func categoryKey(category string) string {
+	if category == "" {
+		return ""
+	}
+
+	h := fnv.New32a()
+	h.Write([]byte(category))
+	return strconv.FormatUint(uint64(h.Sum32()), 36)
+}
+
+func (s *Server) handleTopGivers(w http.ResponseWriter, r *http.Request, i interaction) {
+	period := core.Period(i.Data.stringOption("period"))
+	if _, ok := periodHeadings[period]; !ok {
+		period = core.PeriodAllTime
+	}
+
+	givers, err := s.cr.GetTopGivers(r.Context(), i.GuildID, period, 10, 0)
+	if err != nil {
+		s.l.Errorw("error checking top givers", "err", err)
+		http.Error(w, fmt.Sprintf("error checking top givers: %s", err), http.StatusInternalServerError)
+		return
+	}
+
 	b := &strings.Builder{}
-	for j, count := range counts {
-		b.WriteString(fmt.Sprintf("%d. <@%s>: %d karma \\n", j+1, count.UserID, count.Count))
+	b.WriteString(fmt.Sprintf("Most generous %s:\n", periodHeadings[period]))
+	for _, giver := range givers {
+		b.WriteString(fmt.Sprintf("%d. <@%s>: gave %d karma \n", giver.Rank, giver.UserID, giver.Count))
 	}
 
 	writeMsgResponse(w, b.String(), false)
 }
 
+func (s *Server) handleMyRank(w http.ResponseWriter, r *http.Request, i interaction) {
+	userID := i.invoker().ID
+
+	counts, err := s.cr.GetRank(r.Context(), i.GuildID, userID, 2)
+	if errors.Is(err, core.ErrNotRanked) {
+		writeEphemeralResponse(w, "You're not on the leaderboard yet. Go help someone out!")
+		return
+	}
+	if err != nil {
+		s.l.Errorw("error checking rank", "err", err)
+		http.Error(w, fmt.Sprintf("error checking rank: %s", err), http.StatusInternalServerError)
+		return
+	}
+
+	b := &strings.Builder{}
+	for _, count := range counts {
+		if count.UserID == userID {
+			b.WriteString(fmt.Sprintf("**%d. <@%s>: %d karma** \n", count.Rank, count.UserID, count.Count))
+			continue
+		}
+		b.WriteString(fmt.Sprintf("%d. <@%s>: %d karma \n", count.Rank, count.UserID, count.Count))
+	}
+
+	writeMsgResponse(w, b.String(), false)
+}
+
+// How many gifts are shown on each page of a user's history
+const historyPageSize = 5
+
+// The custom IDs of the history's buttons are this prefix followed by the user ID and page
+const historyButtonPrefix = "history"
+
+// Reasons longer than this are cut short in the history
+const historyReasonLength = 200
+
+func (s *Server) handleKarmaHistory(w http.ResponseWriter, r *http.Request, i interaction) {
+	userID := i.Data.stringOption("user")
+
+	data, err := s.karmaHistoryPage(r, i.GuildID, userID, 0)
+	if err != nil {
+		s.l.Errorw("error checking karma history", "err", err)
+		http.Error(w, fmt.Sprintf("error checking karma history: %s", err), http.StatusInternalServerError)
+		return
+	}
+
+	writeResponse(w, interactionResponse{Type: responseChannelMessage, Data: data})
+}
+
+func (s *Server) handleKarmaHistoryButton(w http.ResponseWriter, r *http.Request, i interaction) {
+	userID, page, ok := parseHistoryButton(i.Data.CustomID)
+	if !ok {
+		http.Error(w, "malformed history button", http.StatusBadRequest)
+		return
+	}
+
+	data, err := s.karmaHistoryPage(r, i.GuildID, userID, page)
+	if err != nil {
+		s.l.Errorw("error checking karma history", "err", err)
+		http.Error(w, fmt.Sprintf("error checking karma history: %s", err), http.StatusInternalServerError)
+		return
+	}
+
+	writeResponse(w, interactionResponse{Type: responseUpdateMessage, Data: data})
+}
+
+// historyButtonID builds the custom ID of a button that shows the page of the user's history
+func historyButtonID(userID string, page int) string {
+	return fmt.Sprintf("%s:%s:%d", historyButtonPrefix, userID, page)
+}
+
+// parseHistoryButton reads the user ID and page back out of a history button's custom ID,
+// which looks like history:<user id>:<page>
+func parseHistoryButton(customID string) (string, int, bool) {
+	parts := strings.Split(customID, ":")
+	if len(parts) != 3 || parts[0] != historyButtonPrefix || parts[1] == "" {
+		return "", 0, false
+	}
+	page, err := strconv.Atoi(parts[2])
+	if err != nil || page < 0 {
+		return "", 0, false
+	}
+
+	return parts[1], page, true
+}
+
+// karmaHistoryPage builds an embed listing one page of the karma the user received, with
+// buttons to move between pages
+func (s *Server) karmaHistoryPage(r *http.Request, guildID, userID string, page int) (*responseData, error) {
+	// Ask for one extra to know if there's a next page
+	evs, err := s.cr.GetKarmaHistory(r.Context(), guildID, userID, historyPageSize+1, page*historyPageSize)
+	if err != nil {
+		return nil, err
+	}
+	hasNext := len(evs) > historyPageSize
+	if hasNext {
+		evs = evs[:historyPageSize]
+	}
+
+	b := &strings.Builder{}
+	b.WriteString(fmt.Sprintf("Recent karma for <@%s>\n\n", userID))
+	if len(evs) == 0 {
+		b.WriteString("Nothing here yet.")
+	}
+	for _, ev := range evs {
+		reason := ev.Reason
+		if len([]rune(reason)) > historyReasonLength {
+			reason = string([]rune(reason)[:historyReasonLength]) + "…"
+		}
+		b.WriteString(fmt.Sprintf("**%+d** from <@%s> <t:%d:R>\n> %s\n", ev.Amount, ev.GiverID, ev.CreatedAt, reason))
+	}
+
+	prev := button(historyButtonID(userID, page-1), "Previous")
+	prev.Disabled = page == 0
+	next := button(historyButtonID(userID, page+1), "Next")
+	next.Disabled = !hasNext
+
+	return &responseData{
+		AllowedMentions: &allowedMentions{Parse: []string{}},
+		Embeds: []embed{
+			{
+				Title:       "Karma history",
+				Description: b.String(),
+				Footer:      &embedFooter{Text: fmt.Sprintf("Page %d", page+1)},
+			},
+		},
+		Components: []component{actionRow(prev, next)},
+	}, nil
+}
+
+func (s *Server) handleSeason(w http.ResponseWriter, r *http.Request, i interaction) {
+	number, _ := i.Data.intOption("number")
+
+	season, standings, err := s.cr.GetSeason(r.Context(), i.GuildID, number, 10)
+	if errors.Is(err, core.ErrSeasonNotFound) {
+		writeEphemeralResponse(w, "That season hasn't happened yet.")
+		return
+	}
+	if err != nil {
+		s.l.Errorw("error checking season", "err", err)
+		http.Error(w, fmt.Sprintf("error checking season: %s", err), http.StatusInternalServerError)
+		return
+	}
+
+	b := &strings.Builder{}
+	b.WriteString(fmt.Sprintf("Top karma of season %d, ended <t:%d:D>:\n", season.Number, season.EndedAt))
+	for _, count := range standings {
+		b.WriteString(fmt.Sprintf("%d. <@%s>: %d karma \n", count.Rank, count.UserID, count.Count))
+	}
+
+	writeMsgResponse(w, b.String(), false)
+}
+
+func (s *Server) handleEndSeason(w http.ResponseWriter, r *http.Request, i interaction) {
+	season, standings, err := s.cr.CloseSeason(r.Context(), i.GuildID, 10)
+	if err != nil {
+		s.l.Errorw("error closing season", "err", err)
+		http.Error(w, fmt.Sprintf("error closing season: %s", err), http.StatusInternalServerError)
+		return
+	}
+
+	s.l.Infow("sucessfully closed season", "guild_id", i.GuildID, "season", season.Number, "closed_by", i.invoker().ID)
+
+	b := &strings.Builder{}
+	b.WriteString(fmt.Sprintf("Season %d is over and everyone's karma is back to zero!", season.Number))
+	if len(standings) > 0 {
+		b.WriteString(" Congratulations to the winners:\n")
+	}
+	for _, count := range standings {
+		b.WriteString(fmt.Sprintf("%d. <@%s>: %d karma \n", count.Rank, count.UserID, count.Count))
+	}
+
+	writeMsgResponse(w, b.String(), true)
+}
+
+func (s *Server) handleKarmaAdmin(w http.ResponseWriter, r *http.Request, i interaction) {
+	sub, data := i.Data.subcommand()
+	modID := i.invoker().ID
+	userID := data.stringOption("user")
+
+	var (
+		count models.KarmaCount
+		err   error
+		msg   string
+	)
+	switch sub {
+	case "set":
+		n, _ := data.intOption("count")
+		count, err = s.cr.SetKarma(r.Context(), i.GuildID, modID, userID, n)
+		msg = fmt.Sprintf("<@%s>'s karma has been set to %d.", userID, count.Count)
+	case "adjust":
+		n, _ := data.intOption("amount")
+		count, err = s.cr.AdjustKarma(r.Context(), i.GuildID, modID, userID, n)
+		msg = fmt.Sprintf("<@%s>'s karma has been adjusted by %+d to %d.", userID, n, count.Count)
+	case "reset":
+		count, err = s.cr.ResetKarma(r.Context(), i.GuildID, modID, userID)
+		msg = fmt.Sprintf("<@%s>'s karma has been reset.", userID)
+	case "transfer":
+		fromID, toID := data.stringOption("from"), data.stringOption("to")
+		count, err = s.cr.TransferKarma(r.Context(), i.GuildID, modID, fromID, toID)
+		msg = fmt.Sprintf("<@%s>'s karma and history have been moved to <@%s>, who now has %d karma.", fromID, toID, count.Count)
+	case "audit":
+		s.handleKarmaAudit(w, r, i)
+		return
+	default:
+		writeEphemeralResponse(w, "Unknown subcommand.")
+		return
+	}
+	if errors.Is(err, core.ErrSameUser) {
+		writeEphemeralResponse(w, "Those are the same account.")
+		return
+	}
+	if err != nil {
+		s.l.Errorw("error changing karma", "err", err, "subcommand", sub)
+		http.Error(w, fmt.Sprintf("error changing karma: %s", err), http.StatusInternalServerError)
+		return
+	}
+
+	s.l.Infow("moderator changed karma", "guild_id", i.GuildID, "subcommand", sub, "moderator_id", modID)
+
+	writeEphemeralResponse(w, msg)
+}
+
+func (s *Server) handleKarmaAudit(w http.ResponseWriter, r *http.Request, i interaction) {
+	entries, err := s.cr.GetAuditLog(r.Context(), i.GuildID, 10)
+	if err != nil {
+		s.l.Errorw("error getting audit log", "err", err)
+		http.Error(w, fmt.Sprintf("error getting audit log: %s", err), http.StatusInternalServerError)
+		return
+	}
+
+	b := &strings.Builder{}
+	b.WriteString("Recent karma changes by moderators:\n")
+	if len(entries) == 0 {
+		b.WriteString("Nothing here yet.")
+	}
+	for _, e := range entries {
+		if e.Action == core.AuditTransfer {
+			b.WriteString(fmt.Sprintf("<t:%d:R> <@%s> moved %d karma from <@%s> to <@%s>\n", e.CreatedAt, e.ModeratorID, e.OldCount, e.UserID, e.TargetUserID))
+			continue
+		}
+		b.WriteString(fmt.Sprintf("<t:%d:R> <@%s> used %s on <@%s>: %d → %d\n", e.CreatedAt, e.ModeratorID, e.Action, e.UserID, e.OldCount, e.NewCount))
+	}
+
+	writeEphemeralResponse(w, b.String())
+}
+
 func handleHealthCheck() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {}
 }
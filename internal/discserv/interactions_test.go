@@ -0,0 +1,282 @@
+package discserv
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/jdholdren/karma/internal/core"
+	"github.com/jdholdren/karma/internal/core/models"
+)
+
+// decodeData decodes interaction data the way it comes from discord, so numbers are float64s
+func decodeData(t *testing.T, raw string) interactionData {
+	t.Helper()
+
+	var d interactionData
+	if err := json.Unmarshal([]byte(raw), &d); err != nil {
+		t.Fatalf("unexpected error decoding interaction data: %s", err)
+	}
+
+	return d
+}
+
+func TestIntOption(t *testing.T) {
+	tests := []struct {
+		name   string
+		data   string
+		option string
+		want   int
+		wantOK bool
+	}{
+		{
+			name:   "given",
+			data:   `{"options": [{"name": "amount", "type": 4, "value": 3}]}`,
+			option: "amount",
+			want:   3,
+			wantOK: true,
+		},
+		{
+			name:   "not given",
+			data:   `{"options": [{"name": "user", "type": 6, "value": "1"}]}`,
+			option: "amount",
+		},
+		{
+			name:   "not a number",
+			data:   `{"options": [{"name": "amount", "type": 3, "value": "3"}]}`,
+			option: "amount",
+		},
+		{
+			name:   "no options",
+			data:   `{}`,
+			option: "amount",
+		},
+	}
+
+	for _, tt := range tests {
+		got, ok := decodeData(t, tt.data).intOption(tt.option)
+		if got != tt.want || ok != tt.wantOK {
+			t.Errorf("%s: intOption() = %d, %t, want %d, %t", tt.name, got, ok, tt.want, tt.wantOK)
+		}
+	}
+}
+
+func TestSubcommand(t *testing.T) {
+	tests := []struct {
+		name     string
+		data     string
+		wantName string
+		wantUser string
+		wantAmt  int
+	}{
+		{
+			name: "with options",
+			data: `{"options": [{"name": "adjust", "type": 1, "options": [
+				{"name": "user", "type": 6, "value": "1"},
+				{"name": "amount", "type": 4, "value": -2}
+			]}]}`,
+			wantName: "adjust",
+			wantUser: "1",
+			wantAmt:  -2,
+		},
+		{
+			name:     "without options",
+			data:     `{"options": [{"name": "audit", "type": 1}]}`,
+			wantName: "audit",
+		},
+		{
+			name:     "no subcommand",
+			data:     `{"options": [{"name": "user", "type": 6, "value": "1"}]}`,
+			wantUser: "1",
+		},
+	}
+
+	for _, tt := range tests {
+		name, data := decodeData(t, tt.data).subcommand()
+		if name != tt.wantName {
+			t.Errorf("%s: subcommand() name = %q, want %q", tt.name, name, tt.wantName)
+		}
+		if got := data.stringOption("user"); got != tt.wantUser {
+			t.Errorf("%s: subcommand() user option = %q, want %q", tt.name, got, tt.wantUser)
+		}
+		if got, _ := data.intOption("amount"); got != tt.wantAmt {
+			t.Errorf("%s: subcommand() amount option = %d, want %d", tt.name, got, tt.wantAmt)
+		}
+	}
+}
+
+func TestLeaderboardButton(t *testing.T) {
+	long := strings.Repeat("ü", 100) // Discord's longest category, at two bytes a rune
+
+	tests := []struct {
+		name     string
+		period   core.Period
+		page     int
+		category string
+	}{
+		{name: "all time", period: core.PeriodAllTime, page: 0},
+		{name: "later page", period: core.PeriodWeek, page: 12},
+		{name: "category", period: core.PeriodMonth, page: 1, category: "helpful"},
+		{name: "category with a colon", period: core.PeriodYear, page: 2, category: "help: code"},
+		{name: "long category", period: core.PeriodMonth, page: 99, category: long},
+	}
+
+	for _, tt := range tests {
+		id := leaderboardButtonID(tt.period, tt.page, tt.category)
+		if len(id) > 100 { // Discord's limit on custom IDs
+			t.Errorf("%s: leaderboardButtonID() is %d long, want at most 100", tt.name, len(id))
+		}
+
+		period, page, key, ok := parseLeaderboardButton(id)
+		if !ok {
+			t.Fatalf("%s: parseLeaderboardButton(%q) failed", tt.name, id)
+		}
+		if period != tt.period || page != tt.page || key != categoryKey(tt.category) {
+			t.Errorf("%s: parseLeaderboardButton(%q) = %s, %d, %q, want %s, %d, %q", tt.name, id, period, page, key, tt.period, tt.page, categoryKey(tt.category))
+		}
+	}
+
+	for _, id := range []string{"leaderboard", "leaderboard:week:x:", "leaderboard:week:-1:", "history:1:0:"} {
+		if _, _, _, ok := parseLeaderboardButton(id); ok {
+			t.Errorf("parseLeaderboardButton(%q) succeeded, want it to fail", id)
+		}
+	}
+}
+
+func TestCategoryKey(t *testing.T) {
+	cats := []string{"helpful", "funny", "Helpful", "help: code", strings.Repeat("ü", 100)}
+
+	keys := map[string]string{}
+	for _, cat := range cats {
+		key := categoryKey(cat)
+		if key == "" || strings.Contains(key, ":") {
+			t.Errorf("categoryKey(%q) = %q, want a key without colons", cat, key)
+		}
+		if other, ok := keys[key]; ok {
+			t.Errorf("categoryKey(%q) = %q, the same as for %q", cat, key, other)
+		}
+		keys[key] = cat
+
+		if again := categoryKey(cat); again != key {
+			t.Errorf("categoryKey(%q) = %q then %q, want it to be stable", cat, key, again)
+		}
+	}
+
+	if key := categoryKey(""); key != "" {
+		t.Errorf("categoryKey(\"\") = %q, want empty", key)
+	}
+}
+
+func TestHistoryButton(t *testing.T) {
+	tests := []struct {
+		userID string
+		page   int
+	}{
+		{userID: "123456789012345678", page: 0},
+		{userID: "123456789012345678", page: 7},
+	}
+
+	for _, tt := range tests {
+		id := historyButtonID(tt.userID, tt.page)
+		userID, page, ok := parseHistoryButton(id)
+		if !ok {
+			t.Fatalf("parseHistoryButton(%q) failed", id)
+		}
+		if diff := cmp.Diff([]any{tt.userID, tt.page}, []any{userID, page}); diff != "" {
+			t.Errorf("parseHistoryButton(%q) mismatch (-want +got):\n%s", id, diff)
+		}
+	}
+
+	for _, id := range []string{"history", "history::0", "history:1:x", "history:1:-1", "history:1:0:2", "undo:1:0"} {
+		if _, _, ok := parseHistoryButton(id); ok {
+			t.Errorf("parseHistoryButton(%q) succeeded, want it to fail", id)
+		}
+	}
+}
+
+func TestWriteGiftResponse(t *testing.T) {
+	tests := []struct {
+		name   string
+		reason string
+	}{
+		{name: "plain", reason: "thanks for the help"},
+		{name: "mentions in the reason", reason: "@everyone look what <@&1> and <@2> did"},
+	}
+
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		writeGiftResponse(rec, models.KarmaChange{
+			Event: models.KarmaEvent{ID: 7, ReceiverID: "3", Amount: 1, Reason: tt.reason},
+			Count: models.KarmaCount{UserID: "3", Count: 4},
+		})
+
+		var resp interactionResponse
+		if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+			t.Fatalf("%s: unexpected error decoding response: %s", tt.name, err)
+		}
+
+		// Only the receiver is pinged, never whoever the reason mentions
+		want := &allowedMentions{Parse: []string{}, Users: []string{"3"}}
+		if diff := cmp.Diff(want, resp.Data.AllowedMentions); diff != "" {
+			t.Errorf("%s: writeGiftResponse() allowed mentions mismatch (-want +got):\n%s", tt.name, diff)
+		}
+		if !strings.Contains(resp.Data.Content, tt.reason) {
+			t.Errorf("%s: writeGiftResponse() content = %q, want it to include the reason", tt.name, resp.Data.Content)
+		}
+
+		eventID, ok := parseUndoButton(resp.Data.Components[0].Components[0].CustomID)
+		if !ok || eventID != 7 {
+			t.Errorf("%s: writeGiftResponse() undo button is for %d, %t, want 7", tt.name, eventID, ok)
+		}
+	}
+}
+
+func TestParseUndoButton(t *testing.T) {
+	for _, id := range []string{"undo", "undo:", "undo:x", "undo:0", "gib:1", "history:1:0"} {
+		if _, ok := parseUndoButton(id); ok {
+			t.Errorf("parseUndoButton(%q) succeeded, want it to fail", id)
+		}
+	}
+}
+
+func TestGibModal(t *testing.T) {
+	id := gibModalID("123456789012345678")
+	receiverID, ok := parseGibModal(id)
+	if !ok || receiverID != "123456789012345678" {
+		t.Errorf("parseGibModal(%q) = %q, %t, want 123456789012345678", id, receiverID, ok)
+	}
+
+	for _, id := range []string{"gib", "gib:", "gib:1:2", "undo:1"} {
+		if _, ok := parseGibModal(id); ok {
+			t.Errorf("parseGibModal(%q) succeeded, want it to fail", id)
+		}
+	}
+}
+
+func TestFieldValue(t *testing.T) {
+	// A MODAL_SUBMIT's fields come back nested in action rows
+	data := decodeData(t, `{
+		"custom_id": "gib:1",
+		"components": [
+			{"type": 1, "components": [{"type": 4, "custom_id": "message", "value": "thanks!"}]},
+			{"type": 1, "components": [{"type": 4, "custom_id": "extra", "value": ""}]}
+		]
+	}`)
+
+	tests := []struct {
+		field string
+		want  string
+	}{
+		{field: "message", want: "thanks!"},
+		{field: "extra", want: ""},
+		{field: "missing", want: ""},
+	}
+
+	for _, tt := range tests {
+		if got := data.fieldValue(tt.field); got != tt.want {
+			t.Errorf("fieldValue(%q) = %q, want %q", tt.field, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,148 @@
+package discserv
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// Interaction callback types
+const (
+	responsePong           = 1
+	responseChannelMessage = 4
+	responseUpdateMessage  = 7
+	responseModal          = 9
+)
+
+// Message flags
+const (
+	flagEphemeral = 64
+)
+
+// Component types and styles
+const (
+	componentActionRow = 1
+	componentButton    = 2
+	componentTextInput = 4
+
+	buttonSecondary = 2
+
+	textInputParagraph = 2
+)
+
+// What we send back to Discord in response to an interaction
+type interactionResponse struct {
+	Type uint          `json:"type"`
+	Data *responseData `json:"data,omitempty"`
+}
+
+type responseData struct {
+	Content         string           `json:"content,omitempty"`
+	Flags           uint             `json:"flags,omitempty"`
+	AllowedMentions *allowedMentions `json:"allowed_mentions,omitempty"`
+	Components      []component      `json:"components,omitempty"`
+	Embeds          []embed          `json:"embeds,omitempty"`
+
+	// Only for modals
+	CustomID string `json:"custom_id,omitempty"`
+	Title    string `json:"title,omitempty"`
+}
+
+type embed struct {
+	Title       string       `json:"title,omitempty"`
+	Description string       `json:"description,omitempty"`
+	Color       int          `json:"color,omitempty"`
+	Footer      *embedFooter `json:"footer,omitempty"`
+}
+
+type embedFooter struct {
+	Text string `json:"text"`
+}
+
+type allowedMentions struct {
+	Parse []string `json:"parse"`
+	// Users who can be pinged even though user mentions aren't parsed
+	Users []string `json:"users,omitempty"`
+}
+
+// mentionOnly lets the message ping just the given users, whatever else it mentions
+func mentionOnly(userIDs ...string) *allowedMentions {
+	return &allowedMentions{Parse: []string{}, Users: userIDs}
+}
+
+type component struct {
+	Type       uint        `json:"type"`
+	CustomID   string      `json:"custom_id,omitempty"`
+	Label      string      `json:"label,omitempty"`
+	Style      uint        `json:"style,omitempty"`
+	Disabled   bool        `json:"disabled,omitempty"`
+	Components []component `json:"components,omitempty"`
+
+	// Only for text inputs
+	Required  bool `json:"required,omitempty"`
+	MaxLength int  `json:"max_length,omitempty"`
+}
+
+func actionRow(cs ...component) component {
+	return component{
+		Type:       componentActionRow,
+		Components: cs,
+	}
+}
+
+func button(customID, label string) component {
+	return component{
+		Type:     componentButton,
+		CustomID: customID,
+		Label:    label,
+		Style:    buttonSecondary,
+	}
+}
+
+func textInput(customID, label string, maxLength int) component {
+	return component{
+		Type:      componentTextInput,
+		CustomID:  customID,
+		Label:     label,
+		Style:     textInputParagraph,
+		Required:  true,
+		MaxLength: maxLength,
+	}
+}
+
+func writeResponse(w http.ResponseWriter, resp interactionResponse) {
+	w.Header().Add("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+func writeMsgResponse(w http.ResponseWriter, message string, allowMentions bool) {
+	data := &responseData{Content: message}
+	if !allowMentions {
+		data.AllowedMentions = &allowedMentions{Parse: []string{}}
+	}
+
+	writeResponse(w, interactionResponse{Type: responseChannelMessage, Data: data})
+}
+
+// writeMentionResponse sends a message that can only ping the given users, so mentions typed
+// into a reason don't ping anyone
+func writeMentionResponse(w http.ResponseWriter, message string, userIDs ...string) {
+	writeResponse(w, interactionResponse{
+		Type: responseChannelMessage,
+		Data: &responseData{
+			Content:         message,
+			AllowedMentions: mentionOnly(userIDs...),
+		},
+	})
+}
+
+// Only visible to the user who ran the command
+func writeEphemeralResponse(w http.ResponseWriter, message string) {
+	writeResponse(w, interactionResponse{
+		Type: responseChannelMessage,
+		Data: &responseData{
+			Content:         message,
+			Flags:           flagEphemeral,
+			AllowedMentions: &allowedMentions{Parse: []string{}},
+		},
+	})
+}
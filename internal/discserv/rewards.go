@@ -0,0 +1,124 @@
+package discserv
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/jdholdren/karma/internal/core"
+	"github.com/jdholdren/karma/internal/core/models"
+	"github.com/jdholdren/karma/internal/discord"
+)
+
+// How many times to try giving a role before giving up, and how long to wait after the
+// first failure. The wait doubles after each one, unless discord says how long to wait.
+const (
+	grantAttempts = 5
+	grantBackoff  = 2 * time.Second
+)
+
+// grantRewards gives the receiver any roles they earned with the change. It happens in the
+// background so the interaction can be responded to straight away.
+func (s *Server) grantRewards(change models.KarmaChange) {
+	if len(change.Rewards) == 0 || s.dc == nil {
+		return
+	}
+
+	go func() {
+		for _, reward := range change.Rewards {
+			s.grantReward(change.Count.UserID, reward)
+		}
+	}()
+}
+
+// grantReward gives the user the reward's role, retrying with backoff. Client errors other
+// than being rate limited aren't retried.
+func (s *Server) grantReward(userID string, reward models.RoleReward) {
+	l := s.l.With("guild_id", reward.GuildID, "user_id", userID, "role_id", reward.RoleID)
+
+	wait := grantBackoff
+	for attempt := 1; ; attempt++ {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		err := s.dc.AddMemberRole(ctx, reward.GuildID, userID, reward.RoleID)
+		cancel()
+		if err == nil {
+			l.Infow("granted reward", "threshold", reward.Threshold)
+			return
+		}
+
+		// Client errors like missing permissions won't go away by trying again
+		var se *discord.StatusError
+		isStatus := errors.As(err, &se)
+		if isStatus && !se.Temporary() {
+			l.Errorw("error granting reward", "err", err, "status_code", se.StatusCode)
+			return
+		}
+
+		if attempt == grantAttempts {
+			l.Errorw("giving up granting reward", "err", err, "attempts", attempt)
+			return
+		}
+
+		sleep := wait
+		if isStatus && se.RetryAfter > 0 {
+			sleep = se.RetryAfter
+		}
+
+		l.Warnw("error granting reward, retrying", "err", err, "attempt", attempt, "wait", sleep)
+		time.Sleep(sleep)
+		wait *= 2
+	}
+}
+
+func (s *Server) handleKarmaRewards(w http.ResponseWriter, r *http.Request, i interaction) {
+	sub, data := i.Data.subcommand()
+	threshold, _ := data.intOption("threshold")
+
+	switch sub {
+	case "add":
+		roleID := data.stringOption("role")
+		if err := s.cr.SetRoleReward(r.Context(), i.GuildID, threshold, roleID); err != nil {
+			s.l.Errorw("error setting reward", "err", err)
+			http.Error(w, fmt.Sprintf("error setting reward: %s", err), http.StatusInternalServerError)
+			return
+		}
+
+		writeEphemeralResponse(w, fmt.Sprintf("Everyone who reaches %d karma will now get <@&%s>. Make sure my role is above it.", threshold, roleID))
+	case "remove":
+		err := s.cr.RemoveRoleReward(r.Context(), i.GuildID, threshold)
+		if errors.Is(err, core.ErrRewardNotFound) {
+			writeEphemeralResponse(w, fmt.Sprintf("There's no reward at %d karma.", threshold))
+			return
+		}
+		if err != nil {
+			s.l.Errorw("error removing reward", "err", err)
+			http.Error(w, fmt.Sprintf("error removing reward: %s", err), http.StatusInternalServerError)
+			return
+		}
+
+		writeEphemeralResponse(w, fmt.Sprintf("The reward at %d karma has been removed. Anyone who already has the role keeps it.", threshold))
+	case "list":
+		rewards, err := s.cr.GetRoleRewards(r.Context(), i.GuildID)
+		if err != nil {
+			s.l.Errorw("error getting rewards", "err", err)
+			http.Error(w, fmt.Sprintf("error getting rewards: %s", err), http.StatusInternalServerError)
+			return
+		}
+
+		b := &strings.Builder{}
+		b.WriteString("Roles given out at karma milestones:\n")
+		if len(rewards) == 0 {
+			b.WriteString("None yet. Add one with `/karmarewards add`.")
+		}
+		for _, reward := range rewards {
+			b.WriteString(fmt.Sprintf("%d karma: <@&%s>\n", reward.Threshold, reward.RoleID))
+		}
+
+		writeEphemeralResponse(w, b.String())
+	default:
+		writeEphemeralResponse(w, "Unknown subcommand.")
+	}
+}
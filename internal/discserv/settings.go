@@ -0,0 +1,95 @@
+package discserv
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/jdholdren/karma/internal/core"
+)
+
+func (s *Server) handleKarmaConfig(w http.ResponseWriter, r *http.Request, i interaction) {
+	sub, data := i.Data.subcommand()
+	key := data.stringOption("setting")
+
+	var (
+		gs  core.GuildSettings
+		err error
+	)
+	switch sub {
+	case "view":
+		gs, err = s.cr.GuildSettings(r.Context(), i.GuildID)
+	case "set":
+		gs, err = s.cr.SetGuildSetting(r.Context(), i.GuildID, key, data.stringOption("value"))
+	case "reset":
+		gs, err = s.cr.ResetGuildSetting(r.Context(), i.GuildID, key)
+	default:
+		writeEphemeralResponse(w, "Unknown subcommand.")
+		return
+	}
+	var se core.SettingError
+	if errors.As(err, &se) {
+		writeEphemeralResponse(w, fmt.Sprintf("That doesn't work for %s: %s.", se.Key, se.Reason))
+		return
+	}
+	if errors.Is(err, core.ErrUnknownSetting) {
+		writeEphemeralResponse(w, "That setting doesn't exist.")
+		return
+	}
+	if err != nil {
+		s.l.Errorw("error changing settings", "err", err, "subcommand", sub)
+		http.Error(w, fmt.Sprintf("error changing settings: %s", err), http.StatusInternalServerError)
+		return
+	}
+
+	if sub == "view" {
+		content := describeSettings(gs)
+
+		// Without rewards there are no milestones, so only new leaders get announced
+		if gs.AnnounceChannelID != "" {
+			rewards, err := s.cr.GetRoleRewards(r.Context(), i.GuildID)
+			if err != nil {
+				s.l.Errorw("error getting rewards", "err", err)
+				http.Error(w, fmt.Sprintf("error getting rewards: %s", err), http.StatusInternalServerError)
+				return
+			}
+			if len(rewards) == 0 {
+				content += "\nThere are no /karmarewards totals yet, so there are no milestones to announce, only new leaders."
+			}
+		}
+
+		writeEphemeralResponse(w, content)
+		return
+	}
+
+	s.l.Infow("changed setting", "guild_id", i.GuildID, "subcommand", sub, "setting", key, "changed_by", i.invoker().ID)
+
+	setting, _ := core.LookupSetting(key)
+	msg := fmt.Sprintf("%s is now %s.", key, displayValue(setting.Value(gs)))
+	if setting.AffectsCommands && !s.global {
+		msg += " The commands will update in a moment."
+		go s.syncInBackground(i.GuildID)
+	}
+
+	writeEphemeralResponse(w, msg)
+}
+
+// describeSettings lists each setting with its value and what it does
+func describeSettings(gs core.GuildSettings) string {
+	b := &strings.Builder{}
+	b.WriteString("Karma settings for this server:\n")
+	for _, setting := range core.Settings {
+		b.WriteString(fmt.Sprintf("**%s**: %s\n> %s\n", setting.Key, displayValue(setting.Value(gs)), setting.Description))
+	}
+
+	return b.String()
+}
+
+func displayValue(v string) string {
+	if v == "" {
+		return "none"
+	}
+
+	return fmt.Sprintf("`%s`", v)
+}
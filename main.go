@@ -2,26 +2,43 @@
 Karma runs a Discord webhook server that responds to commands to
 keep a tally per person.
 
-It takes in no flags but multiple environment variables that are documented
-in the README. It will not serve TLS by default, but can be enabled if a
-cert and key file are provided.
+Usage:
+
+	karma [command] [flags]
+
+The commands are:
+
+	serve     run the server, the default when no command is given
+	migrate   run the migrations and exit
+	register  sync commands with discord and exit
+	export    write a guild's karma out as JSON
+	import    replace a guild's karma with JSON written by export
+	admin     set, adjust, reset or transfer someone's karma
+
+Every command takes the same environment variables, documented in the README.
+Run a command with -h to see its flags. The server will not serve TLS by default,
+but can be enabled if a cert and key file are provided.
 
 It's backed by a SQLite DB, but does not reqire CGO to compile. There are migrations
-in the repo that are run on startup before the server listens to connections.
+in the repo that every command runs before doing anything else.
 */
 package main
 
 import (
 	"context"
 	"embed"
+	"flag"
 	"fmt"
 	"log"
 	"net/url"
+	"os"
 	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/jmoiron/sqlx"
 	"github.com/sethvargo/go-envconfig"
+	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
 	_ "modernc.org/sqlite"
 
@@ -35,6 +52,18 @@ import (
 //go:embed migrate/*
 var f embed.FS
 
+// A command is one of the CLI's subcommands, run with the flags after its name
+type command func(ctx context.Context, l *zap.SugaredLogger, cfg config, args []string) error
+
+var commands = map[string]command{
+	"serve":    runServe,
+	"migrate":  runMigrate,
+	"register": runRegister,
+	"export":   runExport,
+	"import":   runImport,
+	"admin":    runAdmin,
+}
+
 func main() {
 	l := logging.NewLogger()
 	defer func() {
@@ -43,61 +72,163 @@ func main() {
 		}
 	}()
 
+	// Serve when there's no command, including when there are only flags
+	name, args := "serve", os.Args[1:]
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		name, args = args[0], args[1:]
+	}
+	cmd, ok := commands[name]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "unknown command %q, see the package docs for the list\n", name)
+		os.Exit(2)
+	}
+
 	l.Debug("parsing config...")
 	var cfg config
 	if err := envconfig.Process(context.Background(), &cfg); err != nil {
 		l.Fatalf("error parsing config: %s", err)
 	}
-	l.Infow("parsed config", "config", cfg)
+	l.Infow("parsed config", "config", cfg, "command", name)
+
+	if err := cmd(context.Background(), l, cfg, args); err != nil {
+		l.Fatalf("error running %s: %s", name, err)
+	}
+}
+
+// runServe syncs commands, unless told to skip it, and serves interactions
+func runServe(ctx context.Context, l *zap.SugaredLogger, cfg config, args []string) error {
+	fs := flag.NewFlagSet("serve", flag.ExitOnError)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
 
-	// Connect to the database
 	sqlDB, err := setupDB(cfg)
 	if err != nil {
-		l.Fatalf("error opening db: %s", err)
+		return fmt.Errorf("error opening db: %s", err)
 	}
 	defer sqlDB.Close()
-	d := db.New(sqlDB)
 
-	cr := core.New(d)
+	cr := newCore(cfg, sqlDB)
+	s, err := newServer(l, cfg, cr)
+	if err != nil {
+		return err
+	}
 
 	if !cfg.SkipRegister {
-		dCli := discord.NewClient(
-			discord.ClientConfig{
-				AppID: cfg.DiscordAppID,
-				Token: cfg.DiscordToken,
-			},
-			l.Named("discord_client"),
-		)
-		for _, guildID := range cfg.DiscordGuildIDs {
-			if err := dCli.RegisterCommands(context.Background(), guildID); err != nil {
-				l.Fatalf("error registering commands for guild '%s': %s", guildID, err)
-			}
+		if err := syncCommands(ctx, l, cfg, cr, s, false, false); err != nil {
+			return err
 		}
 	}
 
+	l.Infof("serving on port %d", cfg.Port)
+	if s.TLSConfig != nil {
+		err = s.ListenAndServeTLS("", "")
+	} else {
+		err = s.ListenAndServe()
+	}
+	if err != nil {
+		return fmt.Errorf("error while serving: %s", err)
+	}
+
+	return nil
+}
+
+// newCore builds the core from the config
+func newCore(cfg config, sqlDB *sqlx.DB) core.Core {
+	return core.New(db.New(sqlDB), core.Config{
+		PairCooldown: cfg.GibCooldown,
+		DailyBudget:  cfg.GibDailyBudget,
+
+		MaxGiftAmount:       cfg.GibMaxAmount,
+		GuildMaxGiftAmounts: cfg.GibGuildMaxAmounts,
+
+		NegativeKarmaGuildIDs: cfg.NegativeKarmaGuildIDs,
+		AllowNegativeTotals:   cfg.AllowNegativeTotals,
+
+		UndoWindow: cfg.UndoWindow,
+
+		Categories:      cfg.GibCategories,
+		GuildCategories: guildCategories(cfg.GibGuildCategories),
+
+		AnnounceChannelIDs: cfg.AnnounceChannelIDs,
+	})
+}
+
+// newServer builds the server, and the discord client it uses, from the config
+func newServer(l *zap.SugaredLogger, cfg config, cr core.Core) (*discserv.Server, error) {
+	dCli := discord.NewClient(
+		discord.ClientConfig{
+			AppID: cfg.DiscordAppID,
+			Token: cfg.DiscordToken,
+		},
+		l.Named("discord_client"),
+	)
 	s, err := discserv.New(
 		l.Named("discserv"),
 		discserv.Config{
-			Port:        cfg.Port,
-			VerifyKey:   cfg.DiscordVerifyKey,
-			TLSCertFile: cfg.TLSCertFile,
-			TLSKeyFile:  cfg.TLSKeyFile,
+			Port:           cfg.Port,
+			VerifyKey:      cfg.DiscordVerifyKey,
+			GuildIDs:       cfg.DiscordGuildIDs,
+			GlobalCommands: cfg.DiscordGlobalCommands,
+			TLSCertFile:    cfg.TLSCertFile,
+			TLSKeyFile:     cfg.TLSKeyFile,
 		},
 		cr,
+		dCli,
 	)
 	if err != nil {
-		l.Fatalf("error creating discord server", "err", err)
+		return nil, fmt.Errorf("error creating discord server: %s", err)
 	}
 
-	l.Infof("serving on port %d", cfg.Port)
-	if s.TLSConfig != nil {
-		err = s.ListenAndServeTLS("", "")
-	} else {
-		err = s.ListenAndServe()
+	return s, nil
+}
+
+// syncCommands syncs the commands of every guild, or the global ones in global mode.
+// Guilds whose commands haven't changed since the last sync are skipped unless forced.
+// A dry run prints what would change instead.
+func syncCommands(ctx context.Context, l *zap.SugaredLogger, cfg config, cr core.Core, s *discserv.Server, dryRun, force bool) error {
+	// Guilds from the env and ones the app was added to since, or in global mode an
+	// empty guild ID for the global commands
+	guildIDs := []string{""}
+	if !cfg.DiscordGlobalCommands {
+		var err error
+		guildIDs, err = cr.GetGuildIDs(ctx)
+		if err != nil {
+			return fmt.Errorf("error getting guilds: %s", err)
+		}
+		for _, guildID := range cfg.DiscordGuildIDs {
+			if !contains(guildIDs, guildID) {
+				guildIDs = append(guildIDs, guildID)
+			}
+		}
 	}
-	if err != nil {
-		l.Errorw("error while serving", "err", err)
+
+	for _, guildID := range guildIDs {
+		// A dry run always checks with discord
+		if !dryRun && !force {
+			changed, err := s.CommandsChanged(ctx, guildID)
+			if err != nil {
+				return fmt.Errorf("error checking commands for guild '%s': %s", guildID, err)
+			}
+			if !changed {
+				l.Infow("commands unchanged since last sync, skipping", "guild_id", guildID)
+				continue
+			}
+		}
+
+		diff, err := s.SyncCommands(ctx, guildID, dryRun)
+		if err != nil {
+			return fmt.Errorf("error syncing commands for guild '%s': %s", guildID, err)
+		}
+
+		if dryRun && guildID == "" {
+			fmt.Printf("global:\n%s\n", diff)
+		} else if dryRun {
+			fmt.Printf("guild %s:\n%s\n", guildID, diff)
+		}
 	}
+
+	return nil
 }
 
 type config struct {
@@ -114,8 +245,32 @@ type config struct {
 	DiscordAppID     string   `env:"DISCORD_APP_ID"`
 	DiscordGuildIDs  []string `env:"DISCORD_GUILD_IDS"`
 	DiscordVerifyKey string   `env:"DISCORD_VERIFY_KEY"`
+	// If commands are registered once for every guild instead of per guild
+	DiscordGlobalCommands bool `env:"DISCORD_GLOBAL_COMMANDS"`
 	// If we should not try to register commands with discord
 	SkipRegister bool `env:"SKIP_REGISTER"`
+
+	// Limits on giving karma
+	GibCooldown    time.Duration `env:"GIB_COOLDOWN"`
+	GibDailyBudget int           `env:"GIB_DAILY_BUDGET"`
+
+	// Gifts of more than one karma
+	GibMaxAmount       int            `env:"GIB_MAX_AMOUNT,default=1"`
+	GibGuildMaxAmounts map[string]int `env:"GIB_GUILD_MAX_AMOUNTS"`
+
+	// Taking karma away
+	NegativeKarmaGuildIDs []string `env:"NEGATIVE_KARMA_GUILD_IDS"`
+	AllowNegativeTotals   bool     `env:"ALLOW_NEGATIVE_TOTALS"`
+
+	// How long someone has to take back a gib
+	UndoWindow time.Duration `env:"UNDO_WINDOW,default=5m"`
+
+	// Categories gibs can be tagged with. Per-guild lists are separated by pipes.
+	GibCategories      []string          `env:"GIB_CATEGORIES"`
+	GibGuildCategories map[string]string `env:"GIB_GUILD_CATEGORIES"`
+
+	// Where each guild's milestones and new leaders are announced
+	AnnounceChannelIDs map[string]string `env:"ANNOUNCE_CHANNEL_IDS"`
 }
 
 func (c config) MarshalLogObject(enc zapcore.ObjectEncoder) error {
@@ -124,7 +279,14 @@ func (c config) MarshalLogObject(enc zapcore.ObjectEncoder) error {
 	enc.AddString("tls_cert_file", c.TLSCertFile)
 	enc.AddString("tls_key_file", c.TLSKeyFile)
 	enc.AddString("discord_app_id", c.DiscordAppID)
+	enc.AddBool("discord_global_commands", c.DiscordGlobalCommands)
 	enc.AddBool("skip_register", c.SkipRegister)
+	enc.AddDuration("gib_cooldown", c.GibCooldown)
+	enc.AddInt("gib_daily_budget", c.GibDailyBudget)
+	enc.AddInt("gib_max_amount", c.GibMaxAmount)
+	enc.AddBool("allow_negative_totals", c.AllowNegativeTotals)
+	enc.AddDuration("undo_window", c.UndoWindow)
+	enc.AddString("gib_categories", strings.Join(c.GibCategories, ","))
 
 	return nil
 }
@@ -137,6 +299,10 @@ func setupDB(c config) (*sqlx.DB, error) {
 	}
 	q := u.Query()
 	q.Add("_journal", "WAL")
+	// Gifts read and then write in one transaction, so take the write lock up front and
+	// wait for it rather than failing with SQLITE_BUSY when two land at once
+	q.Add("_pragma", "busy_timeout(5000)")
+	q.Add("_txlock", "immediate")
 	u.RawQuery = q.Encode()
 
 	db, err := sqlx.Open("sqlite", u.String())
@@ -144,7 +310,17 @@ func setupDB(c config) (*sqlx.DB, error) {
 		return nil, fmt.Errorf("error opening db: %s", err)
 	}
 
-	// Perform migrations
+	// Perform migrations, skipping ones already recorded as applied
+	_, err = db.Exec("CREATE TABLE IF NOT EXISTS `migrations` (name TEXT NOT NULL PRIMARY KEY);")
+	if err != nil {
+		return nil, fmt.Errorf("error creating migrations table: %s", err)
+	}
+
+	var applied []string
+	if err := db.Select(&applied, "SELECT name FROM migrations;"); err != nil {
+		return nil, fmt.Errorf("error reading applied migrations: %s", err)
+	}
+
 	ups, err := f.ReadDir("migrate")
 	if err != nil {
 		return nil, fmt.Errorf("error reading migration dir: %s", err)
@@ -159,6 +335,10 @@ func setupDB(c config) (*sqlx.DB, error) {
 			continue
 		}
 
+		if contains(applied, up.Name()) {
+			continue
+		}
+
 		upBytes, err := f.ReadFile(filepath.Join("migrate", up.Name()))
 		if err != nil {
 			return nil, fmt.Errorf("error reading up file: %s", err)
@@ -168,7 +348,31 @@ func setupDB(c config) (*sqlx.DB, error) {
 		if err != nil {
 			return nil, fmt.Errorf("error executing up query for file %s: %s", up.Name(), err)
 		}
+
+		if _, err := db.Exec("INSERT INTO migrations(name) VALUES (?);", up.Name()); err != nil {
+			return nil, fmt.Errorf("error recording migration %s: %s", up.Name(), err)
+		}
 	}
 
 	return db, nil
 }
+
+// Splits each guild's pipe-separated list of categories
+func guildCategories(raw map[string]string) map[string][]string {
+	cats := make(map[string][]string, len(raw))
+	for guildID, list := range raw {
+		cats[guildID] = strings.Split(list, "|")
+	}
+
+	return cats
+}
+
+func contains(ss []string, s string) bool {
+	for _, v := range ss {
+		if v == s {
+			return true
+		}
+	}
+
+	return false
+}
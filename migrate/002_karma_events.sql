@@ -0,0 +1,14 @@
+CREATE TABLE IF NOT EXISTS `karma_events` (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  guild_id TEXT NOT NULL,
+  giver_id TEXT NOT NULL,
+  receiver_id TEXT NOT NULL,
+  amount INTEGER NOT NULL,
+  reason TEXT NOT NULL,
+  channel_id TEXT NOT NULL,
+  interaction_id TEXT NOT NULL,
+  created_at INTEGER NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS `karma_events_guild_receiver` ON `karma_events` (guild_id, receiver_id, created_at);
+CREATE INDEX IF NOT EXISTS `karma_events_guild_giver` ON `karma_events` (guild_id, giver_id, created_at);
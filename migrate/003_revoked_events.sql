@@ -0,0 +1 @@
+ALTER TABLE `karma_events` ADD COLUMN revoked_at INTEGER;
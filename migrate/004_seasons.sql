@@ -0,0 +1,15 @@
+CREATE TABLE IF NOT EXISTS `seasons` (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  guild_id TEXT NOT NULL,
+  number INTEGER NOT NULL,
+  started_at INTEGER NOT NULL,
+  ended_at INTEGER NOT NULL,
+  UNIQUE(guild_id, number)
+);
+
+CREATE TABLE IF NOT EXISTS `season_standings` (
+  season_id INTEGER NOT NULL,
+  user_id TEXT NOT NULL,
+  count INTEGER NOT NULL,
+  PRIMARY KEY(season_id, user_id)
+);
@@ -0,0 +1 @@
+ALTER TABLE `karma_events` ADD COLUMN category TEXT NOT NULL DEFAULT '';
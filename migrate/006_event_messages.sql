@@ -0,0 +1 @@
+ALTER TABLE `karma_events` ADD COLUMN message_id TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS `karma_audit` (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  guild_id TEXT NOT NULL,
+  moderator_id TEXT NOT NULL,
+  action TEXT NOT NULL,
+  user_id TEXT NOT NULL,
+  target_user_id TEXT NOT NULL,
+  old_count INTEGER NOT NULL,
+  new_count INTEGER NOT NULL,
+  created_at INTEGER NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS `karma_audit_guild` ON `karma_audit` (guild_id, created_at);
@@ -0,0 +1,6 @@
+CREATE TABLE IF NOT EXISTS `role_rewards` (
+  guild_id TEXT NOT NULL,
+  threshold INTEGER NOT NULL,
+  role_id TEXT NOT NULL,
+  PRIMARY KEY (guild_id, threshold)
+);
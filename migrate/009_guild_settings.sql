@@ -0,0 +1,6 @@
+CREATE TABLE IF NOT EXISTS `guild_settings` (
+  guild_id TEXT NOT NULL,
+  key TEXT NOT NULL,
+  value TEXT NOT NULL,
+  PRIMARY KEY (guild_id, key)
+);
@@ -0,0 +1,4 @@
+CREATE TABLE IF NOT EXISTS `guilds` (
+  guild_id TEXT NOT NULL PRIMARY KEY,
+  added_at INTEGER NOT NULL
+);
@@ -0,0 +1,5 @@
+CREATE TABLE IF NOT EXISTS `command_hashes` (
+  guild_id TEXT NOT NULL PRIMARY KEY,
+  hash TEXT NOT NULL,
+  synced_at INTEGER NOT NULL
+);